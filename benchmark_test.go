@@ -199,6 +199,28 @@ func BenchmarkCore(b *testing.B) {
 			}
 		})
 	}
+
+	// The cores above bypass the ECS field encoding, so it is measured through the logger
+	loggers := map[string]zapcore.Level{
+		"ecs_logger/fields":   zap.DebugLevel,
+		"ecs_logger/disabled": zap.InfoLevel,
+	}
+	for name, lvl := range loggers {
+		b.Run(name, func(b *testing.B) {
+			out := testWriteSyncer{}
+			enc := zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig())
+			l := &zapECSLogger{
+				baseLoggerField: baseLoggerField,
+				logger:          zap.New(zapcore.NewCore(enc, &out, lvl)),
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.Debug("fake", fields...)
+				out.reset()
+			}
+		})
+	}
 }
 
 type testWriteSyncer struct {
@@ -225,3 +247,38 @@ func (e testErr) Error() string {
 func (e testErr) Errors() []error {
 	return e.errors
 }
+
+func BenchmarkLabelProviders(b *testing.B) {
+	labels := []zap.Field{
+		zap.String("feature_flags", "checkout-v2,search-v3"),
+		zap.String("config_version", "42"),
+		zap.String("role", "leader"),
+	}
+	provider := LabelProviderFunc(func() []zap.Field { return labels })
+
+	loggers := map[string]func(l *zapECSLogger){
+		"static":  func(l *zapECSLogger) { l.baseLabels = labels },
+		"dynamic": func(l *zapECSLogger) { l.labelProviders = []LabelProvider{provider} },
+		"cached": func(l *zapECSLogger) {
+			l.labelProviders = []LabelProvider{CachedLabelProvider(provider, time.Minute)}
+		},
+	}
+
+	for name, setup := range loggers {
+		b.Run(name, func(b *testing.B) {
+			out := testWriteSyncer{}
+			enc := zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig())
+			l := &zapECSLogger{
+				baseLoggerField: baseLoggerField,
+				logger:          zap.New(zapcore.NewCore(enc, &out, zap.DebugLevel)),
+			}
+			setup(l)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.Info("fake", zap.String("foo", "bar"))
+				out.reset()
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package zapecs
+
+import (
+	"strings"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+)
+
+// newDataStreamDefaults returns the data stream fields added to the entries lacking them, or
+// nil if no default is set
+func newDataStreamDefaults(typ ecs.DataStreamTypeValue, dataset, namespace string) []zap.Field {
+	if typ == "" && dataset == "" && namespace == "" {
+		return nil
+	}
+	return []zap.Field{
+		ecs.DataStreamType(typ),
+		ecs.DataStreamDataset(dataset),
+		ecs.DataStreamNamespace(namespace),
+	}
+}
+
+// sanitizeDataStreamField returns the data stream field as a keyword with its value sanitized,
+// as invalid values prevent the entry from being routed
+func sanitizeDataStreamField(field zap.Field) zap.Field {
+	if !strings.HasPrefix(field.Key, ecs.DataStreamPrefix) {
+		return field
+	}
+	if kf, ok := keywordLabel(field); ok {
+		field = kf
+	}
+	return ecs.SanitizeDataStreamField(field)
+}
+
+// entryDataset returns the sanitized dataset written to both event.dataset and
+// data_stream.dataset, taken from data_stream.dataset, event.dataset or the logger default in
+// that order, and whether the data stream fields are enabled for the entry. Entries are left as
+// is unless the logger has defaults or they have data stream fields
+func (l zapECSLogger) entryDataset(resolved []sourcedField) (dataset string, enabled bool) {
+	enabled = len(l.dataStream) > 0
+	var eventDataset string
+	var hasDataset bool
+	for _, sf := range resolved {
+		switch {
+		case sf.Key == ecs.FieldEventDataset:
+			kf, _ := keywordLabel(sf.Field)
+			eventDataset = kf.String
+		case sf.Key == ecs.FieldDataStreamDataset:
+			kf, _ := keywordLabel(sf.Field)
+			dataset, hasDataset = kf.String, true
+			enabled = true
+		case strings.HasPrefix(sf.Key, ecs.DataStreamPrefix):
+			enabled = true
+		}
+	}
+	if !enabled {
+		return "", false
+	}
+	if !hasDataset {
+		dataset = eventDataset
+	}
+	if dataset == "" {
+		for _, field := range l.dataStream {
+			if field.Key == ecs.FieldDataStreamDataset {
+				dataset = field.String
+			}
+		}
+	}
+	if dataset == "" {
+		return "", true
+	}
+	return ecs.SanitizeDataStreamValue(ecs.FieldDataStreamDataset, dataset), true
+}
+
+// isDatasetKey reports whether the key is one of the dataset fields kept in sync by
+// dataStreamFields
+func isDatasetKey(key string) bool {
+	return key == ecs.FieldEventDataset || key == ecs.FieldDataStreamDataset
+}
+
+// dataStreamFields returns the data stream fields of an entry with data streams enabled: the
+// logger defaults missing from the entry and, if any, the dataset as both event.dataset and
+// data_stream.dataset
+func (l zapECSLogger) dataStreamFields(resolved []sourcedField, dataset string) []zap.Field {
+	fields := make([]zap.Field, 0, len(l.dataStream)+1)
+	for _, field := range l.dataStream {
+		if !isDatasetKey(field.Key) && !hasFieldKey(resolved, field.Key) {
+			fields = append(fields, field)
+		}
+	}
+	if dataset != "" {
+		fields = append(fields, ecs.DataStreamDataset(dataset), ecs.EventDataset(dataset))
+	}
+	return fields
+}
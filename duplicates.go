@@ -0,0 +1,198 @@
+package zapecs
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DuplicatePolicy determines how the fields written to the same key are resolved. Keys are
+// compared as written, so labels.id and id are duplicates as both end up in the labels object.
+// The policy applies across sources, in order of occurrence: the base labels, the With context
+// fields (the parent logger ones first) and the call fields. Tags are never resolved, but merged
+type DuplicatePolicy int
+
+const (
+	// DuplicateFirstWins keeps the first occurrence of each key
+	DuplicateFirstWins DuplicatePolicy = iota
+	// DuplicateLastWins keeps the last occurrence of each key
+	DuplicateLastWins
+	// DuplicateCollect merges the values of each key into an array, in order of occurrence
+	DuplicateCollect
+	// DuplicateCount keeps the first occurrence of each key and counts the discarded ones,
+	// as returned by DuplicateFields
+	DuplicateCount
+)
+
+// sourcedField is an entry field along with its origin and the path it is written to
+type sourcedField struct {
+	zap.Field
+	base bool
+	root bool
+	path fieldPath
+}
+
+// fieldPath is the dotted output path of a field, split into its first element and the rest,
+// so that paths compare as their joined keys would without building them. Fields written to
+// the same path are duplicates
+type fieldPath struct {
+	object string
+	key    string
+}
+
+func (l zapECSLogger) DuplicateFields() uint64 {
+	if l.duplicates == nil {
+		return 0
+	}
+	return atomic.LoadUint64(l.duplicates)
+}
+
+// resolveFields returns the base (static and provided) labels, With context fields and call
+// fields of the entry, in that order, with their duplicated keys resolved according to the
+// duplicate policy. The returned slice belongs to the accumulators
+func (l zapECSLogger) resolveFields(a *fieldAccumulators, fields []zap.Field) []sourcedField {
+	stream := a.stream
+	for _, field := range l.baseLabels {
+		stream = append(stream, sourcedField{Field: field, base: true})
+	}
+	for _, provider := range l.labelProviders {
+		for _, field := range provider.Labels() {
+			stream = append(stream, sourcedField{Field: field, base: true})
+		}
+	}
+	stream = append(stream, l.contextFields...)
+	for _, field := range fields {
+		stream = append(stream, sourcedField{Field: field})
+	}
+	baseRoot := false
+	for i := range stream {
+		stream[i].root = l.isRootField(stream[i])
+		baseRoot = baseRoot || (stream[i].base && stream[i].root)
+	}
+	for i := range stream {
+		// Fields overriding a root level base label are written in its place
+		if baseRoot && !stream[i].root {
+			stream[i].root = hasRootKey(stream, stream[i].Key)
+		}
+		stream[i].path = l.outputPath(stream[i])
+	}
+	a.stream = stream
+
+	if l.duplicatePolicy == DuplicateCollect {
+		a.resolved = resolveCollect(a.resolved, stream)
+		return a.resolved
+	}
+
+	// Index the occurrence kept for each path: the last one under LastWins, the first otherwise
+	for i, field := range stream {
+		if field.Key == ecs.FieldTags {
+			continue
+		}
+		if _, found := a.kept[field.path]; !found || l.duplicatePolicy == DuplicateLastWins {
+			a.kept[field.path] = i
+		}
+	}
+	discarded := 0
+	for i, field := range stream {
+		if field.Key != ecs.FieldTags && a.kept[field.path] != i {
+			discarded++
+			continue
+		}
+		a.resolved = append(a.resolved, field)
+	}
+	if l.duplicatePolicy == DuplicateCount && discarded > 0 && l.duplicates != nil {
+		atomic.AddUint64(l.duplicates, uint64(discarded))
+	}
+	return a.resolved
+}
+
+// hasFieldKey reports whether any of the fields has the given key
+func hasFieldKey(fields []sourcedField, key string) bool {
+	for _, field := range fields {
+		if field.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRootKey reports whether any of the fields is a root level base label with the given key
+func hasRootKey(fields []sourcedField, key string) bool {
+	for _, field := range fields {
+		if field.base && field.root && field.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCollect groups the values of duplicated keys into an array field, placed on the
+// first occurrence. Tags are kept as they are, since they are merged afterwards
+func resolveCollect(resolved, stream []sourcedField) []sourcedField {
+	groups := make(map[fieldPath][]zap.Field, len(stream))
+	for _, field := range stream {
+		groups[field.path] = append(groups[field.path], field.Field)
+	}
+	for _, field := range stream {
+		group, found := groups[field.path]
+		switch {
+		case field.Key == ecs.FieldTags || len(group) == 1:
+			resolved = append(resolved, field)
+		case found:
+			field.Field = zap.Array(field.Key, collectedValues(group))
+			resolved = append(resolved, field)
+			delete(groups, field.path)
+		}
+	}
+	return resolved
+}
+
+// outputPath returns the path the field is written to, following the routing of appendField
+func (l zapECSLogger) outputPath(sf sourcedField) fieldPath {
+	key := sf.Key
+	switch {
+	case key == ecs.FieldTags || sf.root:
+		return splitPath(key)
+	case isNestedKey(key), strings.HasPrefix(key, ecs.LogPrefix),
+		strings.HasPrefix(key, ecs.HTTPPrefix), strings.HasPrefix(key, ecs.EventPrefix):
+		return splitPath(key)
+	case strings.HasPrefix(key, ecs.ErrorPrefix):
+		return fieldPath{object: ecs.ErrorBaseLevelKey, key: reduceKey(sf.Field).Key}
+	case strings.HasPrefix(key, ecs.TracePrefix):
+		return fieldPath{object: ecs.TraceBaseLevelKey, key: reduceKey(sf.Field).Key}
+	}
+	if object, objectKey, ok := l.namespaces.route(key); ok {
+		return fieldPath{object: object, key: objectKey}
+	}
+	if l.labels.policy == LabelsKeyword {
+		if _, ok := keywordLabel(sf.Field); !ok {
+			return fieldPath{object: l.labels.namespace, key: key}
+		}
+	}
+	return fieldPath{object: ecs.FieldLabels, key: reduceKey(sf.Field).Key}
+}
+
+// splitPath splits the dotted key into its first element and the rest of it
+func splitPath(key string) fieldPath {
+	if idx := strings.IndexByte(key, '.'); idx >= 0 {
+		return fieldPath{object: key[:idx], key: key[idx+1:]}
+	}
+	return fieldPath{key: key}
+}
+
+// collectedValues encodes the values of the fields as array elements
+type collectedValues []zap.Field
+
+func (c collectedValues) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, field := range c {
+		m := zapcore.NewMapObjectEncoder()
+		field.AddTo(m)
+		if err := enc.AppendReflected(m.Fields[field.Key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	CloudProviderAWS   = "aws"
+	CloudProviderGCP   = "gcp"
+	CloudProviderAzure = "azure"
+
+	defaultCloudMetadataTimeout = 300 * time.Millisecond
+	maxCloudMetadataSize        = 64 * 1024
+
+	awsTokenPath      = "/latest/api/token"
+	awsIdentityPath   = "/latest/dynamic/instance-identity/document"
+	awsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	awsTokenHeader    = "X-aws-ec2-metadata-token"
+	gcpMetadataPath   = "/computeMetadata/v1/"
+	gcpFlavorHeader   = "Metadata-Flavor"
+	azureMetadataPath = "/metadata/instance/compute?api-version=2021-02-01&format=json"
+	azureHeader       = "Metadata"
+)
+
+// CloudEndpoints are the base URLs of the instance metadata services queried by the CloudDetector
+type CloudEndpoints struct {
+	AWS   string
+	GCP   string
+	Azure string
+}
+
+// DefaultCloudEndpoints are the well known link-local instance metadata services
+var DefaultCloudEndpoints = CloudEndpoints{
+	AWS:   "http://169.254.169.254",
+	GCP:   "http://metadata.google.internal",
+	Azure: "http://169.254.169.254",
+}
+
+// CloudDetector gathers cloud provider metadata from the instance metadata services, falling back
+// to the environment variables set by managed runtimes (lambda, cloud run, app service, etc.)
+type CloudDetector struct {
+	// Endpoints overrides the metadata service URLs. Empty values mean DefaultCloudEndpoints
+	Endpoints CloudEndpoints
+	// Timeout bounds the whole metadata detection. Zero means 300ms
+	Timeout time.Duration
+	// Client performs the metadata requests. Nil means a client bypassing the environment
+	// proxies, since the metadata services are only reachable from the instance
+	Client *http.Client
+	// DisableMetadata skips the metadata services, using only the environment variables
+	DisableMetadata bool
+	// Getenv looks up environment variables. Nil means os.Getenv
+	Getenv func(key string) string
+}
+
+// cloudMetadataClient is the default metadata client. Proxies are never used, as they would
+// either fail to reach the link-local services or receive the instance credentials
+var cloudMetadataClient = newCloudMetadataClient()
+
+func newCloudMetadataClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return &http.Client{Transport: transport}
+}
+
+// DetectCloud returns the cloud field set of the running instance, suitable to be
+// used as base labels of the logger
+func DetectCloud() []zap.Field {
+	return CloudDetector{}.Detect()
+}
+
+// cloudMetadata holds the detected cloud.* values
+type cloudMetadata struct {
+	provider         string
+	region           string
+	availabilityZone string
+	accountID        string
+	instanceID       string
+	instanceName     string
+	machineType      string
+	serviceName      string
+	projectID        string
+}
+
+// Detect returns the detected cloud fields. Metadata that could not be detected is omitted
+func (d CloudDetector) Detect() []zap.Field {
+	md := cloudMetadata{}
+	if !d.DisableMetadata {
+		md = d.detectMetadata()
+	}
+	md.merge(d.detectEnv())
+
+	return md.fields()
+}
+
+// detectMetadata queries all the metadata services concurrently, keeping the first successful
+// response in AWS, GCP, Azure order
+func (d CloudDetector) detectMetadata() cloudMetadata {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = defaultCloudMetadataTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	detectors := []func(context.Context) (cloudMetadata, error){d.detectAWS, d.detectGCP, d.detectAzure}
+	results := make([]cloudMetadata, len(detectors))
+	errs := make([]error, len(detectors))
+
+	wg := sync.WaitGroup{}
+	for i, detector := range detectors {
+		wg.Add(1)
+		go func(i int, detector func(context.Context) (cloudMetadata, error)) {
+			defer wg.Done()
+			results[i], errs[i] = detector(ctx)
+		}(i, detector)
+	}
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] == nil {
+			return results[i]
+		}
+	}
+	return cloudMetadata{}
+}
+
+func (d CloudDetector) detectAWS(ctx context.Context) (cloudMetadata, error) {
+	baseURL := d.endpoint(d.Endpoints.AWS, DefaultCloudEndpoints.AWS)
+
+	// IMDSv2 requires a session token
+	token, err := d.fetch(ctx, http.MethodPut, baseURL+awsTokenPath, map[string]string{awsTokenTTLHeader: "60"})
+	if err != nil {
+		return cloudMetadata{}, err
+	}
+	data, err := d.fetch(ctx, http.MethodGet, baseURL+awsIdentityPath, map[string]string{awsTokenHeader: string(token)})
+	if err != nil {
+		return cloudMetadata{}, err
+	}
+
+	document := struct {
+		AccountID        string `json:"accountId"`
+		AvailabilityZone string `json:"availabilityZone"`
+		Region           string `json:"region"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+	}{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return cloudMetadata{}, err
+	}
+
+	return cloudMetadata{
+		provider:         CloudProviderAWS,
+		region:           document.Region,
+		availabilityZone: document.AvailabilityZone,
+		accountID:        document.AccountID,
+		instanceID:       document.InstanceID,
+		machineType:      document.InstanceType,
+		serviceName:      "ec2",
+	}, nil
+}
+
+func (d CloudDetector) detectGCP(ctx context.Context) (cloudMetadata, error) {
+	baseURL := d.endpoint(d.Endpoints.GCP, DefaultCloudEndpoints.GCP)
+
+	// Each value is fetched from its own path, since the recursive document includes
+	// arbitrary user attributes and may be too large
+	var id, name, zone, machineType, projectID, numericProjectID string
+	values := []struct {
+		path string
+		val  *string
+	}{
+		{"instance/id", &id},
+		{"instance/name", &name},
+		{"instance/zone", &zone},
+		{"instance/machine-type", &machineType},
+		{"project/project-id", &projectID},
+		{"project/numeric-project-id", &numericProjectID},
+	}
+	for _, v := range values {
+		data, err := d.fetch(ctx, http.MethodGet, baseURL+gcpMetadataPath+v.path, map[string]string{gcpFlavorHeader: "Google"})
+		if err != nil {
+			return cloudMetadata{}, err
+		}
+		*v.val = strings.TrimSpace(string(data))
+	}
+
+	// Zone and machine type are returned as resource paths (projects/<id>/zones/<zone>)
+	zone = lastPathToken(zone)
+	return cloudMetadata{
+		provider:         CloudProviderGCP,
+		region:           gcpRegionFromZone(zone),
+		availabilityZone: zone,
+		accountID:        numericProjectID,
+		instanceID:       id,
+		instanceName:     name,
+		machineType:      lastPathToken(machineType),
+		serviceName:      "gce",
+		projectID:        projectID,
+	}, nil
+}
+
+func (d CloudDetector) detectAzure(ctx context.Context) (cloudMetadata, error) {
+	baseURL := d.endpoint(d.Endpoints.Azure, DefaultCloudEndpoints.Azure)
+	data, err := d.fetch(ctx, http.MethodGet, baseURL+azureMetadataPath, map[string]string{azureHeader: "true"})
+	if err != nil {
+		return cloudMetadata{}, err
+	}
+
+	document := struct {
+		Location          string `json:"location"`
+		Name              string `json:"name"`
+		VMID              string `json:"vmId"`
+		VMSize            string `json:"vmSize"`
+		SubscriptionID    string `json:"subscriptionId"`
+		Zone              string `json:"zone"`
+		ResourceGroupName string `json:"resourceGroupName"`
+	}{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return cloudMetadata{}, err
+	}
+
+	return cloudMetadata{
+		provider:         CloudProviderAzure,
+		region:           document.Location,
+		availabilityZone: document.Zone,
+		accountID:        document.SubscriptionID,
+		instanceID:       document.VMID,
+		instanceName:     document.Name,
+		machineType:      document.VMSize,
+		serviceName:      "Virtual Machines",
+		projectID:        document.ResourceGroupName,
+	}, nil
+}
+
+// detectEnv detects the cloud metadata from the environment variables of managed runtimes
+func (d CloudDetector) detectEnv() cloudMetadata {
+	md := cloudMetadata{}
+	switch {
+	case d.getenv("AWS_REGION") != "" || d.getenv("AWS_DEFAULT_REGION") != "":
+		md.provider = CloudProviderAWS
+		md.region = d.firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+		if d.getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+			md.serviceName = "lambda"
+			md.instanceName = d.getenv("AWS_LAMBDA_FUNCTION_NAME")
+		} else if strings.HasPrefix(d.getenv("AWS_EXECUTION_ENV"), "AWS_ECS_FARGATE") {
+			md.serviceName = "fargate"
+		} else if strings.HasPrefix(d.getenv("AWS_EXECUTION_ENV"), "AWS_ECS") {
+			md.serviceName = "ecs"
+		}
+	case d.getenv("K_SERVICE") != "" || d.getenv("GAE_SERVICE") != "" || d.getenv("GOOGLE_CLOUD_PROJECT") != "":
+		md.provider = CloudProviderGCP
+		md.projectID = d.firstEnv("GOOGLE_CLOUD_PROJECT", "GCP_PROJECT", "GCLOUD_PROJECT")
+		md.region = d.getenv("GOOGLE_CLOUD_REGION")
+		if d.getenv("FUNCTION_TARGET") != "" {
+			md.serviceName = "cloudfunctions"
+			md.instanceName = d.getenv("K_SERVICE")
+		} else if d.getenv("K_SERVICE") != "" {
+			md.serviceName = "cloudrun"
+			md.instanceName = d.getenv("K_SERVICE")
+		} else if d.getenv("GAE_SERVICE") != "" {
+			md.serviceName = "app engine"
+			md.instanceName = d.getenv("GAE_SERVICE")
+		}
+	case d.getenv("WEBSITE_SITE_NAME") != "":
+		md.provider = CloudProviderAzure
+		md.serviceName = "app service"
+		md.instanceName = d.getenv("WEBSITE_SITE_NAME")
+		md.region = d.getenv("REGION_NAME")
+		md.projectID = d.getenv("WEBSITE_RESOURCE_GROUP")
+		if d.getenv("FUNCTIONS_WORKER_RUNTIME") != "" {
+			md.serviceName = "functions"
+		}
+	}
+	return md
+}
+
+// merge fills the undetected values with the ones from fallback, as long as both refer to the same provider
+func (md *cloudMetadata) merge(fallback cloudMetadata) {
+	if md.provider == "" {
+		*md = fallback
+		return
+	}
+	if md.provider != fallback.provider {
+		return
+	}
+
+	// Managed runtimes are more specific than the underlying instance service
+	if fallback.serviceName != "" {
+		md.serviceName = fallback.serviceName
+	}
+	fill := func(val *string, fallbackVal string) {
+		if *val == "" {
+			*val = fallbackVal
+		}
+	}
+	fill(&md.region, fallback.region)
+	fill(&md.availabilityZone, fallback.availabilityZone)
+	fill(&md.accountID, fallback.accountID)
+	fill(&md.instanceID, fallback.instanceID)
+	fill(&md.instanceName, fallback.instanceName)
+	fill(&md.machineType, fallback.machineType)
+	fill(&md.projectID, fallback.projectID)
+}
+
+func (md cloudMetadata) fields() []zap.Field {
+	if md.provider == "" {
+		return nil
+	}
+
+	fields := make([]zap.Field, 0, 9)
+	fields = append(fields, CloudProvider(md.provider))
+	appendNonEmpty := func(constructor func(string) zap.Field, val string) {
+		if val != "" {
+			fields = append(fields, constructor(val))
+		}
+	}
+	appendNonEmpty(CloudRegion, md.region)
+	appendNonEmpty(CloudAvailabilityZone, md.availabilityZone)
+	appendNonEmpty(CloudAccountID, md.accountID)
+	appendNonEmpty(CloudInstanceID, md.instanceID)
+	appendNonEmpty(CloudInstanceName, md.instanceName)
+	appendNonEmpty(CloudMachineType, md.machineType)
+	appendNonEmpty(CloudServiceName, md.serviceName)
+	appendNonEmpty(CloudProjectID, md.projectID)
+	return fields
+}
+
+func (d CloudDetector) fetch(ctx context.Context, method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
+
+	client := d.Client
+	if client == nil {
+		client = cloudMetadataClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ecs: cloud metadata request %s %s failed with status %d", method, url, resp.StatusCode)
+	}
+	// Read one more byte than allowed, so that truncated responses are detected
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCloudMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCloudMetadataSize {
+		return nil, fmt.Errorf("ecs: cloud metadata response of %s %s exceeds %d bytes", method, url, maxCloudMetadataSize)
+	}
+	return data, nil
+}
+
+func (d CloudDetector) endpoint(val, defaultVal string) string {
+	if val == "" {
+		val = defaultVal
+	}
+	return strings.TrimSuffix(val, "/")
+}
+
+func (d CloudDetector) getenv(key string) string {
+	if d.Getenv != nil {
+		return d.Getenv(key)
+	}
+	return os.Getenv(key)
+}
+
+func (d CloudDetector) firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if val := d.getenv(key); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+func lastPathToken(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// gcpRegionFromZone trims the zone suffix, as in us-central1-a -> us-central1
+func gcpRegionFromZone(zone string) string {
+	if idx := strings.LastIndex(zone, "-"); idx > 0 {
+		return zone[:idx]
+	}
+	return zone
+}
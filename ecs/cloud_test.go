@@ -0,0 +1,159 @@
+package ecs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMetadataServer(t *testing.T, provider string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case provider == CloudProviderAWS && r.Method == http.MethodPut && r.URL.Path == awsTokenPath:
+			_, _ = w.Write([]byte("token"))
+		case provider == CloudProviderAWS && r.URL.Path == awsIdentityPath && r.Header.Get(awsTokenHeader) == "token":
+			_, _ = w.Write([]byte(`{"accountId":"123456789012","availabilityZone":"us-east-1a","region":"us-east-1",` +
+				`"instanceId":"i-0123456789abcdef0","instanceType":"t3.micro"}`))
+		case provider == CloudProviderGCP && strings.HasPrefix(r.URL.Path, gcpMetadataPath) && r.Header.Get(gcpFlavorHeader) == "Google":
+			value, found := map[string]string{
+				"instance/id":                "4520031799277581759",
+				"instance/name":              "vm-1",
+				"instance/zone":              "projects/42/zones/us-central1-a",
+				"instance/machine-type":      "projects/42/machineTypes/n1-standard-1",
+				"project/project-id":         "acme",
+				"project/numeric-project-id": "42",
+			}[strings.TrimPrefix(r.URL.Path, gcpMetadataPath)]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(value))
+		case provider == CloudProviderAzure && r.URL.Path == "/metadata/instance/compute" && r.Header.Get(azureHeader) == "true":
+			_, _ = w.Write([]byte(`{"location":"westeurope","name":"vm-2","vmId":"02aab8a4-74ef-476e-8182-f6d2ba4166a6",` +
+				`"vmSize":"Standard_A3","subscriptionId":"8d10da13-8125-4ba9-a717-bf7490507b3d","zone":"1","resourceGroupName":"rg"}`))
+		case provider == "oversized" && r.URL.Path == "/metadata/instance/compute":
+			_, _ = w.Write([]byte(`{"location":"westeurope","tags":"` + strings.Repeat("a", maxCloudMetadataSize) + `"}`))
+		case provider == "slow":
+			time.Sleep(300 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func Test_CloudDetector(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		env      map[string]string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "no_cloud",
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "metadata_timeout",
+			provider: "slow",
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "metadata_too_large",
+			provider: "oversized",
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "aws_metadata",
+			provider: CloudProviderAWS,
+			expected: map[string]interface{}{
+				FieldCloudProvider:         "aws",
+				FieldCloudRegion:           "us-east-1",
+				FieldCloudAvailabilityZone: "us-east-1a",
+				FieldCloudAccountID:        "123456789012",
+				FieldCloudInstanceID:       "i-0123456789abcdef0",
+				FieldCloudMachineType:      "t3.micro",
+				FieldCloudServiceName:      "ec2",
+			},
+		},
+		{
+			name:     "gcp_metadata_cloud_run",
+			provider: CloudProviderGCP,
+			env:      map[string]string{"K_SERVICE": "api"},
+			expected: map[string]interface{}{
+				FieldCloudProvider:         "gcp",
+				FieldCloudRegion:           "us-central1",
+				FieldCloudAvailabilityZone: "us-central1-a",
+				FieldCloudAccountID:        "42",
+				FieldCloudInstanceID:       "4520031799277581759",
+				FieldCloudInstanceName:     "vm-1",
+				FieldCloudMachineType:      "n1-standard-1",
+				FieldCloudServiceName:      "cloudrun",
+				FieldCloudProjectID:        "acme",
+			},
+		},
+		{
+			name:     "azure_metadata",
+			provider: CloudProviderAzure,
+			expected: map[string]interface{}{
+				FieldCloudProvider:         "azure",
+				FieldCloudRegion:           "westeurope",
+				FieldCloudAvailabilityZone: "1",
+				FieldCloudAccountID:        "8d10da13-8125-4ba9-a717-bf7490507b3d",
+				FieldCloudInstanceID:       "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+				FieldCloudInstanceName:     "vm-2",
+				FieldCloudMachineType:      "Standard_A3",
+				FieldCloudServiceName:      "Virtual Machines",
+				FieldCloudProjectID:        "rg",
+			},
+		},
+		{
+			name: "aws_lambda_env",
+			env:  map[string]string{"AWS_REGION": "eu-west-1", "AWS_LAMBDA_FUNCTION_NAME": "handler"},
+			expected: map[string]interface{}{
+				FieldCloudProvider:     "aws",
+				FieldCloudRegion:       "eu-west-1",
+				FieldCloudInstanceName: "handler",
+				FieldCloudServiceName:  "lambda",
+			},
+		},
+		{
+			name: "gcp_cloud_run_env",
+			env:  map[string]string{"K_SERVICE": "api", "GOOGLE_CLOUD_PROJECT": "acme"},
+			expected: map[string]interface{}{
+				FieldCloudProvider:     "gcp",
+				FieldCloudInstanceName: "api",
+				FieldCloudServiceName:  "cloudrun",
+				FieldCloudProjectID:    "acme",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMetadataServer(t, tt.provider)
+			defer server.Close()
+
+			detector := CloudDetector{
+				Endpoints: CloudEndpoints{AWS: server.URL, GCP: server.URL, Azure: server.URL},
+				Timeout:   100 * time.Millisecond,
+				Getenv:    func(key string) string { return tt.env[key] },
+			}
+			actual := fieldsAsMap(detector.Detect())
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("unexpected fields:\n\texpected: %v\n\tactual:   %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_CloudMetadataClient(t *testing.T) {
+	// The metadata services are link-local, so the default client never uses a proxy
+	if transport := cloudMetadataClient.Transport.(*http.Transport); transport.Proxy != nil {
+		t.Fatal("expected the metadata client to bypass the proxies")
+	}
+}
@@ -0,0 +1,245 @@
+package ecs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// JSONEncoding is the zap.Config encoding name of the ECS JSON encoder
+	JSONEncoding = "ecs-json"
+	// ConsoleEncoding is the zap.Config encoding name of the ECS console encoder
+	ConsoleEncoding = "ecs-console"
+)
+
+// consoleIndent prefixes the field lines, while nested lines of multi-line values are
+// indented twice
+const consoleIndent = "    "
+
+// consoleObjectOrder is the order of the top level objects rendered by the console encoder,
+// followed by the remaining keys in alphabetical order
+var consoleObjectOrder = []string{HTTPBaseLevelKey, ErrorBaseLevelKey, EventBaseLevelKey, TraceBaseLevelKey, FieldLabels}
+
+func init() {
+	_ = zap.RegisterEncoder(JSONEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return NewJSONEncoder(cfg), nil
+	})
+	_ = zap.RegisterEncoder(ConsoleEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return NewConsoleEncoder(cfg), nil
+	})
+}
+
+// NewDevelopmentConfig returns the zap development config with the ECS console encoder, meant
+// for local development. Stack traces are left to the ECS logger, which captures them as
+// error.stack_trace
+func NewDevelopmentConfig() zap.Config {
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Encoding = ConsoleEncoding
+	cfg.DisableStacktrace = true
+	cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	return cfg
+}
+
+// consoleEncoder is a zapcore.Encoder rendering ECS documents for humans: the timestamp,
+// level, logger and message on the first line, followed by the non-empty fields as
+// indented key.path=value lines
+type consoleEncoder struct {
+	// MapObjectEncoder holds the accumulated context
+	*zapcore.MapObjectEncoder
+	// header encodes the first line. It is never written to, so it can be shared
+	header         zapcore.Encoder
+	lineEnding     string
+	stacktrace     bool
+	encodeTime     zapcore.TimeEncoder
+	encodeDuration zapcore.DurationEncoder
+}
+
+// NewConsoleEncoder returns a console zapcore.Encoder for ECS documents. Times default to
+// ISO 8601 in UTC, durations to their string form and levels to their capitalized name,
+// unless cfg.EncodeTime, cfg.EncodeDuration and cfg.EncodeLevel are set. The log.level and
+// log.logger fields are rendered on the first line, while multi-line values such as stack
+// traces are rendered as they are. As with the zap console encoder, the zap stack trace is
+// rendered after the fields if cfg.StacktraceKey is set
+func NewConsoleEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	if cfg.EncodeTime == nil {
+		cfg.EncodeTime = ISO8601TimeEncoder
+	}
+	if cfg.EncodeDuration == nil {
+		cfg.EncodeDuration = zapcore.StringDurationEncoder
+	}
+	if cfg.EncodeLevel == nil {
+		cfg.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+	if cfg.CallerKey != "" && cfg.EncodeCaller == nil {
+		cfg.EncodeCaller = zapcore.ShortCallerEncoder
+	}
+	if cfg.LineEnding == "" {
+		cfg.LineEnding = zapcore.DefaultLineEnding
+	}
+
+	header := zapcore.EncoderConfig{
+		TimeKey:          FieldTimestamp,
+		LevelKey:         FieldLogLevel,
+		NameKey:          FieldLogger,
+		CallerKey:        cfg.CallerKey,
+		MessageKey:       FieldMessage,
+		EncodeTime:       cfg.EncodeTime,
+		EncodeLevel:      cfg.EncodeLevel,
+		EncodeCaller:     cfg.EncodeCaller,
+		EncodeName:       cfg.EncodeName,
+		LineEnding:       cfg.LineEnding,
+		ConsoleSeparator: cfg.ConsoleSeparator,
+	}
+
+	return &consoleEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		header:           zapcore.NewConsoleEncoder(header),
+		lineEnding:       cfg.LineEnding,
+		stacktrace:       cfg.StacktraceKey != "",
+		encodeTime:       cfg.EncodeTime,
+		encodeDuration:   cfg.EncodeDuration,
+	}
+}
+
+func (e *consoleEncoder) Clone() zapcore.Encoder {
+	clone := *e
+	clone.MapObjectEncoder = zapcore.NewMapObjectEncoder()
+	copyConsoleMap(clone.Fields, e.Fields)
+	return &clone
+}
+
+func (e *consoleEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	m := zapcore.NewMapObjectEncoder()
+	copyConsoleMap(m.Fields, e.Fields)
+	for _, field := range fields {
+		field.AddTo(m)
+	}
+
+	// The level and logger are rendered by the header, so they are removed from the log object
+	if logObject, isObject := m.Fields[LogBaseLevelKey].(map[string]interface{}); isObject {
+		if name, ok := logObject["logger"].(string); ok && ent.LoggerName == "" {
+			ent.LoggerName = name
+		}
+		delete(logObject, "logger")
+		delete(logObject, "level")
+	}
+	stack := ent.Stack
+	ent.Stack = ""
+
+	buf, err := e.header.EncodeEntry(ent, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range consoleObjectOrder {
+		if value, ok := m.Fields[key]; ok {
+			e.appendValue(buf, key, value)
+			delete(m.Fields, key)
+		}
+	}
+	keys := make([]string, 0, len(m.Fields))
+	for key := range m.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.appendValue(buf, key, m.Fields[key])
+	}
+
+	// The zap stack trace follows the fields, as in the zap console encoder
+	if e.stacktrace && stack != "" {
+		buf.AppendString(strings.TrimRight(stack, "\n"))
+		buf.AppendString(e.lineEnding)
+	}
+	return buf, nil
+}
+
+// appendValue appends the value as key=value lines, one per leaf value. Empty objects are
+// skipped
+func (e *consoleEncoder) appendValue(buf *buffer.Buffer, key string, value interface{}) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		e.appendLine(buf, key, value)
+		return
+	}
+
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.appendValue(buf, key+"."+k, object[k])
+	}
+}
+
+// appendLine appends a single key=value line. Multi-line strings are written below the key
+func (e *consoleEncoder) appendLine(buf *buffer.Buffer, key string, value interface{}) {
+	buf.AppendString(consoleIndent)
+	buf.AppendString(key)
+	buf.AppendByte('=')
+
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, "\n") {
+		buf.AppendString(e.formatValue(value))
+		buf.AppendString(e.lineEnding)
+		return
+	}
+
+	buf.AppendString(e.lineEnding)
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		buf.AppendString(consoleIndent + consoleIndent)
+		buf.AppendString(line)
+		buf.AppendString(e.lineEnding)
+	}
+}
+
+// formatValue formats the value of a leaf field, rendering arrays as [a, b] and times and
+// durations with the configured encoders
+func (e *consoleEncoder) formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			elems[i] = e.formatValue(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case time.Time:
+		return fmt.Sprint(encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) { e.encodeTime(v, enc) }))
+	case time.Duration:
+		return fmt.Sprint(encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) { e.encodeDuration(v, enc) }))
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// encodePrimitive returns the value appended by a primitive encoder, such as a TimeEncoder
+func encodePrimitive(encode func(zapcore.PrimitiveArrayEncoder)) interface{} {
+	m := zapcore.NewMapObjectEncoder()
+	_ = m.AddArray("value", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		encode(enc)
+		return nil
+	}))
+	if values, ok := m.Fields["value"].([]interface{}); ok && len(values) == 1 {
+		return values[0]
+	}
+	return m.Fields["value"]
+}
+
+// copyConsoleMap deep copies the encoded objects of src into dst, so that they can be modified
+func copyConsoleMap(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if object, ok := v.(map[string]interface{}); ok {
+			c := make(map[string]interface{}, len(object))
+			copyConsoleMap(c, object)
+			v = c
+		}
+		dst[k] = v
+	}
+}
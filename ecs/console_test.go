@@ -0,0 +1,79 @@
+package ecs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lggomez/zap-ecs/internal/test"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_ConsoleEncoder(t *testing.T) {
+	entry := zapcore.Entry{
+		Level:   zapcore.ErrorLevel,
+		Time:    time.Date(1990, time.November, 26, 17, 56, 11, 31000000, time.FixedZone("ART", -3*60*60)),
+		Message: "this is a test message",
+	}
+	object := func(fields ...zap.Field) zapcore.ObjectMarshaler {
+		return zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for _, field := range fields {
+				field.AddTo(enc)
+			}
+			return nil
+		})
+	}
+
+	testName := "simple"
+	t.Run(testName, func(t *testing.T) {
+		buf, err := NewConsoleEncoder(zapcore.EncoderConfig{}).EncodeEntry(entry, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+
+	testName = "ecs_document"
+	t.Run(testName, func(t *testing.T) {
+		enc := NewConsoleEncoder(zapcore.EncoderConfig{EncodeLevel: zapcore.CapitalColorLevelEncoder})
+		enc.AddString(FieldServiceName, "encoder.test")
+
+		buf, err := enc.Clone().EncodeEntry(entry, []zapcore.Field{
+			zap.Strings(FieldTags, []string{"env", "checkout"}),
+			zap.Object(LogBaseLevelKey, object(
+				zap.String("logger", "ecs.test"),
+				zap.String("level", "error"),
+				zap.Object("origin", object(zap.String("function", "main.main"))),
+			)),
+			zap.Object(HTTPBaseLevelKey, object()),
+			zap.Object(EventBaseLevelKey, object(zap.String("action", "order-placed"), zap.Int("severity", 3))),
+			zap.Object(ErrorBaseLevelKey, object(
+				zap.String("message", "fail"),
+				zap.String("stack_trace", "goroutine 1 [running]:\nmain.main()\n\t/src/main.go:42 +0x1d\n"),
+			)),
+			zap.Object(TraceBaseLevelKey, object()),
+			zap.Object(FieldLabels, object(zap.String("foo", "bar"))),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+
+	testName = "stack_and_times"
+	t.Run(testName, func(t *testing.T) {
+		// The zap stack trace follows the fields, while times and durations use the encoders
+		enc := NewConsoleEncoder(zapcore.EncoderConfig{StacktraceKey: "stacktrace", EncodeDuration: zapcore.NanosDurationEncoder})
+		stackEntry := entry
+		stackEntry.Stack = "main.main\n\t/src/main.go:42\n"
+
+		buf, err := enc.EncodeEntry(stackEntry, []zapcore.Field{
+			zap.Object(EventBaseLevelKey, object(zap.Time("start", entry.Time), zap.Duration("duration", time.Second))),
+			zap.Times("times", []time.Time{entry.Time}),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+}
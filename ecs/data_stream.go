@@ -0,0 +1,119 @@
+package ecs
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DataStreamTypeValue is an allowed value of the data_stream.type field:
+// https://www.elastic.co/guide/en/ecs/current/ecs-data_stream.html
+type DataStreamTypeValue string
+
+const (
+	DataStreamTypeLogs       DataStreamTypeValue = "logs"
+	DataStreamTypeMetrics    DataStreamTypeValue = "metrics"
+	DataStreamTypeTraces     DataStreamTypeValue = "traces"
+	DataStreamTypeSynthetics DataStreamTypeValue = "synthetics"
+)
+
+const (
+	// DefaultDataStreamType, DefaultDataStreamDataset and DefaultDataStreamNamespace are the
+	// values used by Elastic when the data stream fields are missing or empty
+	DefaultDataStreamType      = DataStreamTypeLogs
+	DefaultDataStreamDataset   = "generic"
+	DefaultDataStreamNamespace = "default"
+
+	// maxDataStreamValueLength is the maximum length in bytes of the dataset and namespace
+	maxDataStreamValueLength = 100
+	// dataStreamInvalidChars are the characters not allowed in the data stream fields. The
+	// hyphen is reserved as the separator of the data stream name components
+	dataStreamInvalidChars = `\/*?"<>| ,#:-`
+	// dataStreamInvalidPrefixes are the characters the data stream fields cannot start with
+	dataStreamInvalidPrefixes = "-_+"
+)
+
+var dataStreamTypes = map[string]struct{}{
+	string(DataStreamTypeLogs): {}, string(DataStreamTypeMetrics): {}, string(DataStreamTypeTraces): {},
+	string(DataStreamTypeSynthetics): {},
+}
+
+// DataStreamName returns the name of the data stream the documents with the given fields are
+// routed to, <type>-<dataset>-<namespace>. The values are sanitized, with empty ones replaced
+// by their defaults
+func DataStreamName(typ DataStreamTypeValue, dataset, namespace string) string {
+	return SanitizeDataStreamValue(FieldDataStreamType, string(typ)) + "-" +
+		SanitizeDataStreamValue(FieldDataStreamDataset, dataset) + "-" +
+		SanitizeDataStreamValue(FieldDataStreamNamespace, namespace)
+}
+
+// SanitizeDataStreamValue returns the value of the data stream field with the given key
+// following the Elastic naming restrictions: lowercase, with the invalid characters replaced by
+// underscores, no leading underscores and up to 100 bytes. Empty values, and types other than
+// the allowed ones, are replaced by their defaults, while values of any other key are returned
+// as is
+func SanitizeDataStreamValue(key, value string) string {
+	var def string
+	switch key {
+	case FieldDataStreamType:
+		def = string(DefaultDataStreamType)
+	case FieldDataStreamDataset:
+		def = DefaultDataStreamDataset
+	case FieldDataStreamNamespace:
+		def = DefaultDataStreamNamespace
+	default:
+		return value
+	}
+
+	value = strings.TrimLeft(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(dataStreamInvalidChars, r) {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(value)), dataStreamInvalidPrefixes)
+	if len(value) > maxDataStreamValueLength {
+		value = strings.ToValidUTF8(value[:maxDataStreamValueLength], "")
+	}
+	if value == "" || value == "." || value == ".." {
+		return def
+	}
+	if key == FieldDataStreamType {
+		if _, allowed := dataStreamTypes[value]; !allowed {
+			return def
+		}
+	}
+	return value
+}
+
+// SanitizeDataStreamField returns the data stream field with its value sanitized by
+// SanitizeDataStreamValue. Fields with any other key or a non string value are returned as is
+func SanitizeDataStreamField(field zap.Field) zap.Field {
+	if field.Type != zapcore.StringType || !strings.HasPrefix(field.Key, DataStreamPrefix) {
+		return field
+	}
+	field.String = SanitizeDataStreamValue(field.Key, field.String)
+	return field
+}
+
+// ValidateDataStreamField checks the value of the data stream fields against the Elastic naming
+// restrictions and, for data_stream.type, the allowed values. Fields with any other key are
+// always valid
+func ValidateDataStreamField(field zap.Field) error {
+	if !strings.HasPrefix(field.Key, DataStreamPrefix) {
+		return nil
+	}
+	if field.Type != zapcore.StringType {
+		return fmt.Errorf("ecs: %s must be a string", field.Key)
+	}
+	if field.Key == FieldDataStreamType {
+		if _, allowed := dataStreamTypes[field.String]; !allowed {
+			return fmt.Errorf("ecs: %q is not an allowed value of %s", field.String, field.Key)
+		}
+	}
+	if sanitized := SanitizeDataStreamValue(field.Key, field.String); sanitized != field.String {
+		return fmt.Errorf("ecs: %q is not a valid value of %s", field.String, field.Key)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package ecs
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func Test_SanitizeDataStreamValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		value    string
+		expected string
+	}{
+		{name: "valid", key: FieldDataStreamDataset, value: "myservice.access", expected: "myservice.access"},
+		{name: "uppercase", key: FieldDataStreamNamespace, value: "Production", expected: "production"},
+		{name: "invalid_chars", key: FieldDataStreamDataset, value: `my-service/access logs:v1`, expected: "my_service_access_logs_v1"},
+		{name: "invalid_prefix", key: FieldDataStreamNamespace, value: "-_+staging", expected: "staging"},
+		{name: "too_long", key: FieldDataStreamDataset, value: strings.Repeat("a", 120), expected: strings.Repeat("a", 100)},
+		{name: "empty_type", key: FieldDataStreamType, value: "", expected: "logs"},
+		{name: "allowed_type", key: FieldDataStreamType, value: "Metrics", expected: "metrics"},
+		{name: "disallowed_type", key: FieldDataStreamType, value: "events", expected: "logs"},
+		{name: "empty_dataset", key: FieldDataStreamDataset, value: "", expected: "generic"},
+		{name: "dot_namespace", key: FieldDataStreamNamespace, value: "..", expected: "default"},
+		{name: "other_key", key: FieldEventDataset, value: "My-Service", expected: "My-Service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeDataStreamValue(tt.key, tt.value); got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_ValidateDataStreamField(t *testing.T) {
+	tests := []struct {
+		name  string
+		field zap.Field
+		valid bool
+	}{
+		{name: "valid_type", field: DataStreamType(DataStreamTypeMetrics), valid: true},
+		{name: "invalid_type", field: zap.String(FieldDataStreamType, "events"), valid: false},
+		{name: "valid_dataset", field: DataStreamDataset("My-Service"), valid: true},
+		{name: "invalid_dataset", field: zap.String(FieldDataStreamDataset, "My-Service"), valid: false},
+		{name: "non_string_namespace", field: zap.Int(FieldDataStreamNamespace, 1), valid: false},
+		{name: "other_key", field: zap.String(FieldEventDataset, "My-Service"), valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateDataStreamField(tt.field); (err == nil) != tt.valid {
+				t.Fatalf("expected valid %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func Test_DataStreamName(t *testing.T) {
+	if got := DataStreamName("", "My Service", ""); got != "logs-my_service-default" {
+		t.Fatalf("unexpected data stream name %q", got)
+	}
+	if got := DataStreamName("events", "myservice", "production"); got != "logs-myservice-production" {
+		t.Fatalf("unexpected data stream name %q", got)
+	}
+}
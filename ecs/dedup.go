@@ -0,0 +1,341 @@
+package ecs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// FieldLabelRepeatCount is the label with the number of suppressed repetitions of an entry
+const FieldLabelRepeatCount = "labels.repeat_count"
+
+// DedupCore is a zapcore.Core suppressing the entries identical to one written within the
+// window: same level, message and fields, regardless of the timestamp. The first entry is
+// written right away, while its repetitions are reported by a single document with event.start
+// and event.end (the first and last occurrences) and labels.repeat_count (the number of
+// repetitions), written by a timer once the window ends, or by the next Write or Sync if they
+// happen first. Entries above the error level are never suppressed
+type DedupCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out zapcore.WriteSyncer
+	d   *deduper
+}
+
+// deduper holds the state shared by a core and its children
+type deduper struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]*repeatedEntry
+	nextExpiry time.Time
+	// timer reports the repetitions at nextExpiry, while there are entries
+	timer *time.Timer
+}
+
+// DedupConfig configures a DedupCore
+type DedupConfig struct {
+	// Window is the time an entry suppresses its repetitions
+	Window time.Duration
+	// Clock returns the current time, used for the windows and the event.start and event.end of
+	// the repetitions. Nil means time.Now
+	Clock func() time.Time
+}
+
+// repeatedEntry is a written entry along with its repetitions
+type repeatedEntry struct {
+	core        *DedupCore
+	ent         zapcore.Entry
+	fields      []capturedField
+	first, last time.Time
+	count       uint64
+}
+
+// capturedField is an encoded field value, captured since the entry fields may be reused once
+// written
+type capturedField struct {
+	key   string
+	value interface{}
+}
+
+// NewDedupCore returns a core encoding the entries with enc, such as the ECS JSON encoder,
+// and writing them to ws unless they repeat an entry written within the window. Since the
+// repetitions may be written by a timer, ws must be safe for concurrent use (see zapcore.Lock)
+func NewDedupCore(enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler, window time.Duration) *DedupCore {
+	return NewDedupCoreWithConfig(enc, ws, enab, DedupConfig{Window: window})
+}
+
+// NewDedupCoreWithConfig returns a DedupCore configured by cfg
+func NewDedupCoreWithConfig(enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler, cfg DedupConfig) *DedupCore {
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+	return &DedupCore{
+		LevelEnabler: enab,
+		enc:          enc,
+		out:          ws,
+		d: &deduper{
+			window:  cfg.Window,
+			now:     cfg.Clock,
+			entries: map[string]*repeatedEntry{},
+		},
+	}
+}
+
+func (c *DedupCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return &DedupCore{LevelEnabler: c.LevelEnabler, enc: enc, out: c.out, d: c.d}
+}
+
+func (c *DedupCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *DedupCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level > zapcore.ErrorLevel {
+		if err := c.write(ent, fields); err != nil {
+			return err
+		}
+		return c.Sync()
+	}
+
+	// Entries are identified by their encoding without the timestamp
+	idEnt := ent
+	idEnt.Time = time.Time{}
+	id, err := c.enc.EncodeEntry(idEnt, fields)
+	if err != nil {
+		return err
+	}
+	key := id.String()
+	id.Free()
+
+	now := c.d.now()
+	c.d.mu.Lock()
+	expired := c.d.expire(now, false)
+	r, repeated := c.d.entries[key]
+	if repeated {
+		r.count++
+		r.last = now
+	} else {
+		c.d.track(key, &repeatedEntry{core: c, ent: ent, fields: captureFields(fields), first: now, last: now})
+	}
+	c.d.schedule(now)
+	c.d.mu.Unlock()
+
+	if err = writeRepeated(expired, now); err != nil || repeated {
+		return err
+	}
+	return c.write(ent, fields)
+}
+
+// Sync writes the pending repetitions, regardless of their window, and syncs the WriteSyncer
+func (c *DedupCore) Sync() error {
+	now := c.d.now()
+	c.d.mu.Lock()
+	expired := c.d.expire(now, true)
+	c.d.schedule(now)
+	c.d.mu.Unlock()
+
+	if err := writeRepeated(expired, now); err != nil {
+		return err
+	}
+	return c.out.Sync()
+}
+
+func (c *DedupCore) write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(buf.Bytes())
+	buf.Free()
+	return err
+}
+
+// writeRepeated writes a document for each entry with repetitions, through the core of each entry
+func writeRepeated(entries []*repeatedEntry, now time.Time) error {
+	for _, r := range entries {
+		ent := r.ent
+		ent.Time = now
+		if err := r.core.write(ent, r.repeatFields()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// track adds the entry, scheduling its expiry. The caller must hold mu
+func (d *deduper) track(key string, r *repeatedEntry) {
+	d.entries[key] = r
+	if expiry := r.first.Add(d.window); len(d.entries) == 1 || expiry.Before(d.nextExpiry) {
+		d.nextExpiry = expiry
+	}
+}
+
+// schedule sets the timer to the next expiry, or stops it if there are no entries. The caller
+// must hold mu
+func (d *deduper) schedule(now time.Time) {
+	if len(d.entries) == 0 {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		return
+	}
+	delay := d.nextExpiry.Sub(now)
+	if d.timer == nil {
+		d.timer = time.AfterFunc(delay, d.expireOnTimer)
+		return
+	}
+	d.timer.Reset(delay)
+}
+
+// expireOnTimer writes the repetitions of the entries whose window ended
+func (d *deduper) expireOnTimer() {
+	now := d.now()
+	d.mu.Lock()
+	expired := d.expire(now, false)
+	d.schedule(now)
+	d.mu.Unlock()
+
+	// There is no caller to report the error to, as with the zap cores writing in the background
+	_ = writeRepeated(expired, now)
+}
+
+// expire removes the entries whose window ended (or all of them if forced), returning the ones
+// with repetitions sorted by their first occurrence. The caller must hold mu
+func (d *deduper) expire(now time.Time, force bool) []*repeatedEntry {
+	if len(d.entries) == 0 || !force && now.Before(d.nextExpiry) {
+		return nil
+	}
+
+	var expired []*repeatedEntry
+	d.nextExpiry = time.Time{}
+	for key, r := range d.entries {
+		expiry := r.first.Add(d.window)
+		if force || !now.Before(expiry) {
+			delete(d.entries, key)
+			if r.count > 0 {
+				expired = append(expired, r)
+			}
+			continue
+		}
+		if d.nextExpiry.IsZero() || expiry.Before(d.nextExpiry) {
+			d.nextExpiry = expiry
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].first.Before(expired[j].first)
+	})
+	return expired
+}
+
+// repeatFields returns the captured fields, adding the repetition fields to the event and
+// labels objects
+func (r *repeatedEntry) repeatFields() []zapcore.Field {
+	event := map[string]interface{}{}
+	labels := map[string]interface{}{}
+	fields := make([]zapcore.Field, 0, len(r.fields)+2)
+	for _, f := range r.fields {
+		switch object, isObject := f.value.(map[string]interface{}); {
+		case f.key == EventBaseLevelKey && isObject:
+			event = object
+		case f.key == FieldLabels && isObject:
+			labels = object
+		default:
+			fields = append(fields, f.field())
+		}
+	}
+
+	event[strings.TrimPrefix(FieldEventStart, EventPrefix)] = r.first
+	event[strings.TrimPrefix(FieldEventEnd, EventPrefix)] = r.last
+	labels[strings.TrimPrefix(FieldLabelRepeatCount, FieldLabels+".")] = r.count
+	return append(fields,
+		zap.Object(EventBaseLevelKey, capturedObject(event)),
+		zap.Object(FieldLabels, capturedObject(labels)))
+}
+
+// captureFields encodes the fields into their plain values
+func captureFields(fields []zapcore.Field) []capturedField {
+	captured := make([]capturedField, 0, len(fields))
+	for _, field := range fields {
+		m := zapcore.NewMapObjectEncoder()
+		field.AddTo(m)
+		keys := make([]string, 0, len(m.Fields))
+		for key := range m.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			captured = append(captured, capturedField{key: key, value: m.Fields[key]})
+		}
+	}
+	return captured
+}
+
+// field returns the captured value as a field. Objects and arrays are encoded natively, so that
+// the encoder settings (such as the time encoding) apply to their values
+func (f capturedField) field() zapcore.Field {
+	switch v := f.value.(type) {
+	case map[string]interface{}:
+		return zap.Object(f.key, capturedObject(v))
+	case []interface{}:
+		return zap.Array(f.key, capturedArray(v))
+	default:
+		return zap.Any(f.key, v)
+	}
+}
+
+// capturedObject encodes a captured object, sorting its keys
+type capturedObject map[string]interface{}
+
+func (o capturedObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		capturedField{key: key, value: o[key]}.field().AddTo(enc)
+	}
+	return nil
+}
+
+// capturedArray encodes a captured array
+type capturedArray []interface{}
+
+func (a capturedArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, value := range a {
+		var err error
+		switch v := value.(type) {
+		case map[string]interface{}:
+			err = enc.AppendObject(capturedObject(v))
+		case []interface{}:
+			err = enc.AppendArray(capturedArray(v))
+		case string:
+			enc.AppendString(v)
+		case bool:
+			enc.AppendBool(v)
+		case time.Time:
+			enc.AppendTime(v)
+		case time.Duration:
+			enc.AppendDuration(v)
+		default:
+			err = enc.AppendReflected(v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
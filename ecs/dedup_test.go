@@ -0,0 +1,113 @@
+package ecs
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lggomez/zap-ecs/internal/test"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_DedupCore(t *testing.T) {
+	start := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+	now := start
+	buf := &bytes.Buffer{}
+	core := NewDedupCoreWithConfig(NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.AddSync(buf), zap.DebugLevel, DedupConfig{
+		Window: 10 * time.Second,
+		Clock:  func() time.Time { return now },
+	})
+	// Stop the expiry timer of the pending entries
+	defer core.Sync()
+
+	entry := func(msg string) zapcore.Entry {
+		return zapcore.Entry{Level: zapcore.ErrorLevel, Time: now, Message: msg}
+	}
+	object := func(fields ...zap.Field) zapcore.ObjectMarshaler {
+		return zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for _, field := range fields {
+				field.AddTo(enc)
+			}
+			return nil
+		})
+	}
+	fields := func() []zapcore.Field {
+		return []zapcore.Field{
+			zap.Strings(FieldTags, []string{"env"}),
+			zap.Object(EventBaseLevelKey, object(zap.String("action", "connect"))),
+			zap.Object(FieldLabels, object(zap.String("host", "db"))),
+		}
+	}
+	write := func(at time.Duration, c zapcore.Core, msg string) {
+		t.Helper()
+		now = start.Add(at)
+		if err := c.Write(entry(msg), fields()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	testName := "dedup"
+	t.Run(testName, func(t *testing.T) {
+		write(0, core, "connection refused")
+		write(time.Second, core, "connection refused")
+		write(2*time.Second, core, "query failed")
+		write(3*time.Second, core, "connection refused")
+		// Entries with a different context are not repetitions
+		write(4*time.Second, core.With([]zapcore.Field{zap.String(FieldServiceName, "api")}), "connection refused")
+
+		// The window of the first entry ends, so its 2 repetitions are reported
+		write(11*time.Second, core, "query failed")
+		// Pending repetitions are reported on sync
+		now = start.Add(12 * time.Second)
+		if err := core.Sync(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Entries are written again after their window
+		write(13*time.Second, core, "connection refused")
+
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+}
+
+// lockedBuffer is a buffer safe for concurrent writes and reads
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func Test_DedupCoreTimer(t *testing.T) {
+	buf := &lockedBuffer{}
+	core := NewDedupCore(NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.AddSync(buf), zap.DebugLevel, 10*time.Millisecond)
+
+	// The repetitions are reported once the window ends, without waiting for another entry
+	for i := 0; i < 3; i++ {
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now(), Message: "connection refused"}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(buf.String(), `"repeat_count":2`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the repetitions to be reported, got %v", buf.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 2 {
+		t.Fatalf("expected the entry and its repetitions, got %v", buf.String())
+	}
+}
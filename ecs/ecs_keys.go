@@ -4,10 +4,11 @@ package ecs
 // https://www.elastic.co/guide/en/ecs/current/ecs-base.html
 const (
 	// Internal base fields to be used by the logger
-	FieldTimestamp = "@timestamp"
-	FieldMessage   = "message"
-	FieldLabels    = "labels"
-	FieldTags      = "tags"
+	FieldTimestamp  = "@timestamp"
+	FieldMessage    = "message"
+	FieldLabels     = "labels"
+	FieldTags       = "tags"
+	FieldECSVersion = "ecs.version"
 
 	// Internal label fields to be used by the logger
 	FieldLabelApplication = "application"
@@ -15,12 +16,18 @@ const (
 	FieldLabelEnvironment = "environment"
 	FieldLabelLibVersion  = "lib_version"
 	FieldLabelLibLanguage = "lib_language"
-	FieldLabelPodName     = "pod_name"
-	FieldLabelNodeName    = "node_name"
+	// Deprecated: use FieldKubernetesPodName, see DetectKubernetes
+	FieldLabelPodName = "pod_name"
+	// Deprecated: use FieldKubernetesNodeName, see DetectKubernetes
+	FieldLabelNodeName = "node_name"
 
 	FieldLogger   = "log.logger"
 	FieldLogLevel = "log.level"
 
+	FieldLogOriginFileName = "log.origin.file.name"
+	FieldLogOriginFileLine = "log.origin.file.line"
+	FieldLogOriginFunction = "log.origin.function"
+
 	// Public fields to be available for consumers
 	FieldServiceName = "service.name"
 
@@ -36,8 +43,119 @@ const (
 	FieldEventOriginal = "event.original"
 	FieldEventOutcome  = "event.outcome"
 
+	FieldEventID        = "event.id"
+	FieldEventCode      = "event.code"
+	FieldEventDuration  = "event.duration"
+	FieldEventStart     = "event.start"
+	FieldEventEnd       = "event.end"
+	FieldEventCreated   = "event.created"
+	FieldEventIngested  = "event.ingested"
+	FieldEventSequence  = "event.sequence"
+	FieldEventSeverity  = "event.severity"
+	FieldEventRiskScore = "event.risk_score"
+	FieldEventReason    = "event.reason"
+	FieldEventReference = "event.reference"
+	FieldEventDataset   = "event.dataset"
+	FieldEventProvider  = "event.provider"
+	FieldEventTimezone  = "event.timezone"
+	FieldEventHash      = "event.hash"
+
 	FieldTraceID = "trace.id"
 
+	FieldDataStreamType      = "data_stream.type"
+	FieldDataStreamDataset   = "data_stream.dataset"
+	FieldDataStreamNamespace = "data_stream.namespace"
+
+	FieldProcessPID              = "process.pid"
+	FieldProcessPPID             = "process.ppid"
+	FieldProcessName             = "process.name"
+	FieldProcessExecutable       = "process.executable"
+	FieldProcessArgs             = "process.args"
+	FieldProcessWorkingDirectory = "process.working_directory"
+	FieldProcessStart            = "process.start"
+	FieldProcessEnd              = "process.end"
+	FieldProcessExitCode         = "process.exit_code"
+	FieldProcessThreadID         = "process.thread.id"
+	FieldProcessTitle            = "process.title"
+
+	FieldContainerID        = "container.id"
+	FieldContainerName      = "container.name"
+	FieldContainerRuntime   = "container.runtime"
+	FieldContainerImageName = "container.image.name"
+	FieldContainerImageTag  = "container.image.tag"
+
+	FieldOrchestratorType         = "orchestrator.type"
+	FieldOrchestratorNamespace    = "orchestrator.namespace"
+	FieldOrchestratorResourceName = "orchestrator.resource.name"
+	FieldOrchestratorResourceType = "orchestrator.resource.type"
+
+	FieldKubernetesNamespace = "kubernetes.namespace"
+	FieldKubernetesNodeName  = "kubernetes.node.name"
+	FieldKubernetesPodName   = "kubernetes.pod.name"
+	FieldKubernetesPodUID    = "kubernetes.pod.uid"
+	FieldKubernetesPodIP     = "kubernetes.pod.ip"
+
+	FieldCloudProvider         = "cloud.provider"
+	FieldCloudRegion           = "cloud.region"
+	FieldCloudAvailabilityZone = "cloud.availability_zone"
+	FieldCloudAccountID        = "cloud.account.id"
+	FieldCloudInstanceID       = "cloud.instance.id"
+	FieldCloudInstanceName     = "cloud.instance.name"
+	FieldCloudMachineType      = "cloud.machine.type"
+	FieldCloudServiceName      = "cloud.service.name"
+	FieldCloudProjectID        = "cloud.project.id"
+
+	FieldUserID          = "user.id"
+	FieldUserName        = "user.name"
+	FieldUserFullName    = "user.full_name"
+	FieldUserEmail       = "user.email"
+	FieldUserDomain      = "user.domain"
+	FieldUserRoles       = "user.roles"
+	FieldUserHash        = "user.hash"
+	FieldUserGroupID     = "user.group.id"
+	FieldUserGroupName   = "user.group.name"
+	FieldUserGroupDomain = "user.group.domain"
+
+	FieldUserTargetID          = "user.target.id"
+	FieldUserTargetName        = "user.target.name"
+	FieldUserTargetFullName    = "user.target.full_name"
+	FieldUserTargetEmail       = "user.target.email"
+	FieldUserTargetDomain      = "user.target.domain"
+	FieldUserTargetRoles       = "user.target.roles"
+	FieldUserTargetHash        = "user.target.hash"
+	FieldUserTargetGroupID     = "user.target.group.id"
+	FieldUserTargetGroupName   = "user.target.group.name"
+	FieldUserTargetGroupDomain = "user.target.group.domain"
+
+	FieldUserEffectiveID          = "user.effective.id"
+	FieldUserEffectiveName        = "user.effective.name"
+	FieldUserEffectiveFullName    = "user.effective.full_name"
+	FieldUserEffectiveEmail       = "user.effective.email"
+	FieldUserEffectiveDomain      = "user.effective.domain"
+	FieldUserEffectiveRoles       = "user.effective.roles"
+	FieldUserEffectiveHash        = "user.effective.hash"
+	FieldUserEffectiveGroupID     = "user.effective.group.id"
+	FieldUserEffectiveGroupName   = "user.effective.group.name"
+	FieldUserEffectiveGroupDomain = "user.effective.group.domain"
+
+	FieldUserChangesID          = "user.changes.id"
+	FieldUserChangesName        = "user.changes.name"
+	FieldUserChangesFullName    = "user.changes.full_name"
+	FieldUserChangesEmail       = "user.changes.email"
+	FieldUserChangesDomain      = "user.changes.domain"
+	FieldUserChangesRoles       = "user.changes.roles"
+	FieldUserChangesHash        = "user.changes.hash"
+	FieldUserChangesGroupID     = "user.changes.group.id"
+	FieldUserChangesGroupName   = "user.changes.group.name"
+	FieldUserChangesGroupDomain = "user.changes.group.domain"
+
+	FieldGroupID     = "group.id"
+	FieldGroupName   = "group.name"
+	FieldGroupDomain = "group.domain"
+
+	FieldOrganizationID   = "organization.id"
+	FieldOrganizationName = "organization.name"
+
 	FieldHTTPRequestBodyContent   = "http.request.body.content"
 	FieldHTTPRequestMethod        = "http.request.method"
 	FieldHTTPRequestBodyHeaders   = "http.request.body.headers"
@@ -54,7 +172,8 @@ func IsECSFieldName(fieldName string) bool {
 
 // Internal lookup map for ECS keys on log fields
 var ecsKeysMap = map[string]struct{}{
-	FieldTags: {},
+	FieldTags:       {},
+	FieldECSVersion: {},
 
 	FieldLogger:           {},
 	FieldLogLevel:         {},
@@ -66,6 +185,10 @@ var ecsKeysMap = map[string]struct{}{
 	FieldLabelPodName:     {},
 	FieldLabelNodeName:    {},
 
+	FieldLogOriginFileName: {},
+	FieldLogOriginFileLine: {},
+	FieldLogOriginFunction: {},
+
 	FieldServiceName: {},
 
 	FieldErrorMessage: {},
@@ -73,14 +196,126 @@ var ecsKeysMap = map[string]struct{}{
 	FieldErrorType:    {},
 
 	FieldEventAction:   {},
+	FieldEventKind:     {},
 	FieldEventCategory: {},
 	FieldEventModule:   {},
 	FieldEventType:     {},
 	FieldEventOriginal: {},
 	FieldEventOutcome:  {},
 
+	FieldEventID:        {},
+	FieldEventCode:      {},
+	FieldEventDuration:  {},
+	FieldEventStart:     {},
+	FieldEventEnd:       {},
+	FieldEventCreated:   {},
+	FieldEventIngested:  {},
+	FieldEventSequence:  {},
+	FieldEventSeverity:  {},
+	FieldEventRiskScore: {},
+	FieldEventReason:    {},
+	FieldEventReference: {},
+	FieldEventDataset:   {},
+	FieldEventProvider:  {},
+	FieldEventTimezone:  {},
+	FieldEventHash:      {},
+
 	FieldTraceID: {},
 
+	FieldDataStreamType:      {},
+	FieldDataStreamDataset:   {},
+	FieldDataStreamNamespace: {},
+
+	FieldProcessPID:              {},
+	FieldProcessPPID:             {},
+	FieldProcessName:             {},
+	FieldProcessExecutable:       {},
+	FieldProcessArgs:             {},
+	FieldProcessWorkingDirectory: {},
+	FieldProcessStart:            {},
+	FieldProcessEnd:              {},
+	FieldProcessExitCode:         {},
+	FieldProcessThreadID:         {},
+	FieldProcessTitle:            {},
+
+	FieldContainerID:        {},
+	FieldContainerName:      {},
+	FieldContainerRuntime:   {},
+	FieldContainerImageName: {},
+	FieldContainerImageTag:  {},
+
+	FieldOrchestratorType:         {},
+	FieldOrchestratorNamespace:    {},
+	FieldOrchestratorResourceName: {},
+	FieldOrchestratorResourceType: {},
+
+	FieldKubernetesNamespace: {},
+	FieldKubernetesNodeName:  {},
+	FieldKubernetesPodName:   {},
+	FieldKubernetesPodUID:    {},
+	FieldKubernetesPodIP:     {},
+
+	FieldCloudProvider:         {},
+	FieldCloudRegion:           {},
+	FieldCloudAvailabilityZone: {},
+	FieldCloudAccountID:        {},
+	FieldCloudInstanceID:       {},
+	FieldCloudInstanceName:     {},
+	FieldCloudMachineType:      {},
+	FieldCloudServiceName:      {},
+	FieldCloudProjectID:        {},
+
+	FieldUserID:          {},
+	FieldUserName:        {},
+	FieldUserFullName:    {},
+	FieldUserEmail:       {},
+	FieldUserDomain:      {},
+	FieldUserRoles:       {},
+	FieldUserHash:        {},
+	FieldUserGroupID:     {},
+	FieldUserGroupName:   {},
+	FieldUserGroupDomain: {},
+
+	FieldUserTargetID:          {},
+	FieldUserTargetName:        {},
+	FieldUserTargetFullName:    {},
+	FieldUserTargetEmail:       {},
+	FieldUserTargetDomain:      {},
+	FieldUserTargetRoles:       {},
+	FieldUserTargetHash:        {},
+	FieldUserTargetGroupID:     {},
+	FieldUserTargetGroupName:   {},
+	FieldUserTargetGroupDomain: {},
+
+	FieldUserEffectiveID:          {},
+	FieldUserEffectiveName:        {},
+	FieldUserEffectiveFullName:    {},
+	FieldUserEffectiveEmail:       {},
+	FieldUserEffectiveDomain:      {},
+	FieldUserEffectiveRoles:       {},
+	FieldUserEffectiveHash:        {},
+	FieldUserEffectiveGroupID:     {},
+	FieldUserEffectiveGroupName:   {},
+	FieldUserEffectiveGroupDomain: {},
+
+	FieldUserChangesID:          {},
+	FieldUserChangesName:        {},
+	FieldUserChangesFullName:    {},
+	FieldUserChangesEmail:       {},
+	FieldUserChangesDomain:      {},
+	FieldUserChangesRoles:       {},
+	FieldUserChangesHash:        {},
+	FieldUserChangesGroupID:     {},
+	FieldUserChangesGroupName:   {},
+	FieldUserChangesGroupDomain: {},
+
+	FieldGroupID:     {},
+	FieldGroupName:   {},
+	FieldGroupDomain: {},
+
+	FieldOrganizationID:   {},
+	FieldOrganizationName: {},
+
 	FieldHTTPRequestBodyContent:   {},
 	FieldHTTPRequestMethod:        {},
 	FieldHTTPRequestBodyHeaders:   {},
@@ -105,4 +340,31 @@ const (
 
 	TracePrefix       = "trace."
 	TraceBaseLevelKey = "trace"
+
+	ProcessPrefix       = "process."
+	ProcessBaseLevelKey = "process"
+
+	ContainerPrefix       = "container."
+	ContainerBaseLevelKey = "container"
+
+	OrchestratorPrefix       = "orchestrator."
+	OrchestratorBaseLevelKey = "orchestrator"
+
+	KubernetesPrefix       = "kubernetes."
+	KubernetesBaseLevelKey = "kubernetes"
+
+	CloudPrefix       = "cloud."
+	CloudBaseLevelKey = "cloud"
+
+	UserPrefix       = "user."
+	UserBaseLevelKey = "user"
+
+	GroupPrefix       = "group."
+	GroupBaseLevelKey = "group"
+
+	OrganizationPrefix       = "organization."
+	OrganizationBaseLevelKey = "organization"
+
+	DataStreamPrefix       = "data_stream."
+	DataStreamBaseLevelKey = "data_stream"
 )
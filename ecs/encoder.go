@@ -0,0 +1,332 @@
+package ecs
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Version is the ECS version written by the ECS encoder
+const Version = "8.11.0"
+
+// timestampLayout is the ISO 8601 layout, with millisecond precision, required by ecs-logging
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+var bufferPool = buffer.NewPool()
+
+// jsonEncoder is a zapcore.Encoder following the ecs-logging specification:
+// https://github.com/elastic/ecs-logging/blob/main/spec/spec.json
+type jsonEncoder struct {
+	// Encoder encodes the entry fields and holds the accumulated context
+	zapcore.Encoder
+	// header encodes the mandatory fields. It is never written to, so it can be shared
+	header zapcore.Encoder
+}
+
+// NewJSONEncoder returns a JSON zapcore.Encoder following the ecs-logging specification. The
+// @timestamp, log.level and message keys are written first and in that order, followed by
+// ecs.version and log.logger (from the logger name), regardless of the cfg keys. @timestamp is
+// always written in ISO 8601 in UTC, so configs such as zap.NewProductionEncoderConfig() can be
+// used as they are, while cfg.EncodeTime only applies to the time fields of the entry (ISO 8601
+// if nil). Since the level and logger name are written natively, log.level (and log.logger, if
+// the logger is named) are dropped from the log object. The caller and stack trace are written
+// as configured by cfg
+func NewJSONEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	if cfg.EncodeTime == nil {
+		cfg.EncodeTime = ISO8601TimeEncoder
+	}
+	if cfg.CallerKey != "" && cfg.EncodeCaller == nil {
+		cfg.EncodeCaller = zapcore.ShortCallerEncoder
+	}
+
+	header := zapcore.EncoderConfig{
+		TimeKey:        FieldTimestamp,
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: cfg.EncodeDuration,
+		LineEnding:     cfg.LineEnding,
+	}
+
+	// Mandatory keys are written by the header encoder
+	cfg.TimeKey = ""
+	cfg.LevelKey = ""
+	cfg.MessageKey = ""
+	cfg.NameKey = ""
+
+	return &jsonEncoder{
+		Encoder: zapcore.NewJSONEncoder(cfg),
+		header:  zapcore.NewJSONEncoder(header),
+	}
+}
+
+// NewEncoderConfig returns the encoder config of ECS documents, encoding times in ISO 8601 in UTC
+// and durations in nanoseconds as ECS expects, with the stack trace written as error.stack_trace
+func NewEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        FieldTimestamp,
+		LevelKey:       FieldLogLevel,
+		NameKey:        FieldLogger,
+		MessageKey:     FieldMessage,
+		StacktraceKey:  FieldStackTrace,
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: zapcore.NanosDurationEncoder,
+	}
+}
+
+// ISO8601TimeEncoder encodes the time in UTC with millisecond precision, as required by ecs-logging
+func ISO8601TimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(t.UTC().Format(timestampLayout))
+}
+
+func (e *jsonEncoder) Clone() zapcore.Encoder {
+	return &jsonEncoder{
+		Encoder: e.Encoder.Clone(),
+		header:  e.header,
+	}
+}
+
+func (e *jsonEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	headerFields := [4]zapcore.Field{
+		zap.String(FieldLogLevel, ent.Level.String()),
+		zap.String(FieldMessage, ent.Message),
+		zap.String(FieldECSVersion, Version),
+	}
+	n := 3
+	if ent.LoggerName != "" {
+		headerFields[n] = zap.String(FieldLogger, ent.LoggerName)
+		n++
+	}
+	header, err := e.header.EncodeEntry(zapcore.Entry{Time: ent.Time}, headerFields[:n])
+	if err != nil {
+		return nil, err
+	}
+	defer header.Free()
+
+	body, err := e.Encoder.EncodeEntry(ent, withoutHeaderKeys(fields, ent.LoggerName != ""))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Free()
+
+	// Splice both objects: {header} + {body} = {header,body}
+	headerBytes, bodyBytes := header.Bytes(), body.Bytes()
+	headerEnd := lastObjectEnd(headerBytes)
+	bodyEnd := lastObjectEnd(bodyBytes)
+
+	buf := bufferPool.Get()
+	buf.Write(headerBytes[:headerEnd])
+	if bodyEnd > 1 {
+		buf.AppendByte(',')
+		buf.Write(bodyBytes[1:])
+	} else {
+		buf.Write(headerBytes[headerEnd:])
+	}
+	return buf, nil
+}
+
+// withoutHeaderKeys returns the fields with the keys written by the header (level, and logger
+// if named) dropped from the log object. The fields are copied only if there is a log object
+func withoutHeaderKeys(fields []zapcore.Field, named bool) []zapcore.Field {
+	for i, field := range fields {
+		if field.Key != LogBaseLevelKey || field.Type != zapcore.ObjectMarshalerType {
+			continue
+		}
+		filtered := make([]zapcore.Field, 0, len(fields))
+		filtered = append(filtered, fields[:i]...)
+		filtered = append(filtered, zap.Object(LogBaseLevelKey, &logObject{
+			ObjectMarshaler: field.Interface.(zapcore.ObjectMarshaler),
+			named:           named,
+		}))
+		return append(filtered, fields[i+1:]...)
+	}
+	return fields
+}
+
+// logObject marshals the log object without the keys written by the header
+type logObject struct {
+	zapcore.ObjectMarshaler
+	named bool
+}
+
+func (o *logObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return o.ObjectMarshaler.MarshalLogObject(&headerKeysFilter{ObjectEncoder: enc, named: o.named})
+}
+
+// headerKeysFilter is an ObjectEncoder dropping the keys written by the header, leaving the
+// encoding of the rest to the wrapped encoder. Keys within a namespace are kept
+type headerKeysFilter struct {
+	zapcore.ObjectEncoder
+	named      bool
+	namespaced bool
+}
+
+// skip reports whether the key is written by the header
+func (f *headerKeysFilter) skip(key string) bool {
+	return !f.namespaced && (key == "level" || (f.named && key == "logger"))
+}
+
+func (f *headerKeysFilter) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	if f.skip(key) {
+		return nil
+	}
+	return f.ObjectEncoder.AddArray(key, marshaler)
+}
+
+func (f *headerKeysFilter) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	if f.skip(key) {
+		return nil
+	}
+	return f.ObjectEncoder.AddObject(key, marshaler)
+}
+
+func (f *headerKeysFilter) AddBinary(key string, value []byte) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddBinary(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddByteString(key string, value []byte) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddByteString(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddBool(key string, value bool) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddBool(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddComplex128(key string, value complex128) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddComplex128(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddComplex64(key string, value complex64) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddComplex64(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddDuration(key string, value time.Duration) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddDuration(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddFloat64(key string, value float64) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddFloat64(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddFloat32(key string, value float32) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddFloat32(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddInt(key string, value int) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddInt(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddInt64(key string, value int64) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddInt64(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddInt32(key string, value int32) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddInt32(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddInt16(key string, value int16) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddInt16(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddInt8(key string, value int8) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddInt8(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddString(key, value string) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddString(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddTime(key string, value time.Time) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddTime(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddUint(key string, value uint) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddUint(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddUint64(key string, value uint64) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddUint64(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddUint32(key string, value uint32) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddUint32(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddUint16(key string, value uint16) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddUint16(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddUint8(key string, value uint8) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddUint8(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddUintptr(key string, value uintptr) {
+	if !f.skip(key) {
+		f.ObjectEncoder.AddUintptr(key, value)
+	}
+}
+
+func (f *headerKeysFilter) AddReflected(key string, value interface{}) error {
+	if f.skip(key) {
+		return nil
+	}
+	return f.ObjectEncoder.AddReflected(key, value)
+}
+
+func (f *headerKeysFilter) OpenNamespace(key string) {
+	f.namespaced = true
+	f.ObjectEncoder.OpenNamespace(key)
+}
+
+// lastObjectEnd returns the index of the closing brace of the encoded object, which is
+// followed by the line ending
+func lastObjectEnd(b []byte) int {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] == '}' {
+			return i
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,104 @@
+package ecs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lggomez/zap-ecs/internal/test"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_JSONEncoder(t *testing.T) {
+	entry := zapcore.Entry{
+		Level:   zapcore.WarnLevel,
+		Time:    time.Date(1990, time.November, 26, 17, 56, 11, 31000000, time.FixedZone("ART", -3*60*60)),
+		Message: "this is a test message",
+	}
+
+	testName := "simple"
+	t.Run(testName, func(t *testing.T) {
+		buf, err := NewJSONEncoder(zapcore.EncoderConfig{}).EncodeEntry(entry, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+
+	testName = "all_fields"
+	t.Run(testName, func(t *testing.T) {
+		enc := NewJSONEncoder(zapcore.EncoderConfig{
+			// Mandatory keys are always written as ECS requires
+			TimeKey:       "ts",
+			LevelKey:      "level",
+			MessageKey:    "msg",
+			NameKey:       "name",
+			CallerKey:     "caller",
+			StacktraceKey: FieldStackTrace,
+		})
+		enc.AddString(FieldServiceName, "encoder.test")
+
+		namedEntry := entry
+		namedEntry.LoggerName = "ecs.test"
+		namedEntry.Caller = zapcore.NewEntryCaller(0, "/src/zap-ecs/ecs/encoder_test.go", 42, true)
+		namedEntry.Stack = "stacktrace"
+		buf, err := enc.Clone().EncodeEntry(namedEntry, []zapcore.Field{
+			zap.String("foo", "bar"),
+			zap.Error(errors.New("fail")),
+			zap.Object(EventBaseLevelKey, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("kind", string(EventKindEvent))
+				return nil
+			})),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+
+	testName = "log_object"
+	t.Run(testName, func(t *testing.T) {
+		// log.level is written natively, so it is dropped from the log object
+		buf, err := NewJSONEncoder(zap.NewProductionEncoderConfig()).EncodeEntry(entry, []zapcore.Field{
+			zap.Object(LogBaseLevelKey, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("level", "warn")
+				enc.AddString("logger", "ecs.test")
+				return enc.AddObject("origin", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+					enc.AddInt("file.line", 42)
+					return nil
+				}))
+			})),
+			zap.Time("event.start", entry.Time),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+
+	testName = "log_object_named"
+	t.Run(testName, func(t *testing.T) {
+		// log.logger is written natively for named loggers, while the rest of the log object
+		// keeps the configured encoders
+		namedEntry := entry
+		namedEntry.LoggerName = "svc"
+		buf, err := NewJSONEncoder(zap.NewProductionEncoderConfig()).EncodeEntry(namedEntry, []zapcore.Field{
+			zap.Object(LogBaseLevelKey, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("level", "warn")
+				enc.AddString("logger", "ecs.test")
+				enc.AddTime("start", entry.Time)
+				enc.AddDuration("elapsed", time.Second)
+				return nil
+			})),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := strings.Count(buf.String(), `"logger"`); got != 0 {
+			t.Errorf("expected log.logger to be written by the header only, got %v", buf.String())
+		}
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+}
@@ -0,0 +1,148 @@
+package ecs
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// EventKindValue is an ECS allowed value of the event.kind field:
+// https://www.elastic.co/guide/en/ecs/current/ecs-allowed-values-event-kind.html
+type EventKindValue string
+
+const (
+	EventKindAlert         EventKindValue = "alert"
+	EventKindAsset         EventKindValue = "asset"
+	EventKindEnrichment    EventKindValue = "enrichment"
+	EventKindEvent         EventKindValue = "event"
+	EventKindMetric        EventKindValue = "metric"
+	EventKindState         EventKindValue = "state"
+	EventKindPipelineError EventKindValue = "pipeline_error"
+	EventKindSignal        EventKindValue = "signal"
+)
+
+// EventCategoryValue is an ECS allowed value of the event.category field:
+// https://www.elastic.co/guide/en/ecs/current/ecs-allowed-values-event-category.html
+type EventCategoryValue string
+
+const (
+	EventCategoryAPI                EventCategoryValue = "api"
+	EventCategoryAuthentication     EventCategoryValue = "authentication"
+	EventCategoryConfiguration      EventCategoryValue = "configuration"
+	EventCategoryDatabase           EventCategoryValue = "database"
+	EventCategoryDriver             EventCategoryValue = "driver"
+	EventCategoryEmail              EventCategoryValue = "email"
+	EventCategoryFile               EventCategoryValue = "file"
+	EventCategoryHost               EventCategoryValue = "host"
+	EventCategoryIAM                EventCategoryValue = "iam"
+	EventCategoryIntrusionDetection EventCategoryValue = "intrusion_detection"
+	EventCategoryLibrary            EventCategoryValue = "library"
+	EventCategoryMalware            EventCategoryValue = "malware"
+	EventCategoryNetwork            EventCategoryValue = "network"
+	EventCategoryPackage            EventCategoryValue = "package"
+	EventCategoryProcess            EventCategoryValue = "process"
+	EventCategoryRegistry           EventCategoryValue = "registry"
+	EventCategorySession            EventCategoryValue = "session"
+	EventCategoryThreat             EventCategoryValue = "threat"
+	EventCategoryVulnerability      EventCategoryValue = "vulnerability"
+	EventCategoryWeb                EventCategoryValue = "web"
+)
+
+// EventTypeValue is an ECS allowed value of the event.type field:
+// https://www.elastic.co/guide/en/ecs/current/ecs-allowed-values-event-type.html
+type EventTypeValue string
+
+const (
+	EventTypeAccess       EventTypeValue = "access"
+	EventTypeAdmin        EventTypeValue = "admin"
+	EventTypeAllowed      EventTypeValue = "allowed"
+	EventTypeChange       EventTypeValue = "change"
+	EventTypeConnection   EventTypeValue = "connection"
+	EventTypeCreation     EventTypeValue = "creation"
+	EventTypeDeletion     EventTypeValue = "deletion"
+	EventTypeDenied       EventTypeValue = "denied"
+	EventTypeEnd          EventTypeValue = "end"
+	EventTypeError        EventTypeValue = "error"
+	EventTypeGroup        EventTypeValue = "group"
+	EventTypeIndicator    EventTypeValue = "indicator"
+	EventTypeInfo         EventTypeValue = "info"
+	EventTypeInstallation EventTypeValue = "installation"
+	EventTypeProtocol     EventTypeValue = "protocol"
+	EventTypeStart        EventTypeValue = "start"
+	EventTypeUser         EventTypeValue = "user"
+)
+
+// EventOutcomeValue is an ECS allowed value of the event.outcome field:
+// https://www.elastic.co/guide/en/ecs/current/ecs-allowed-values-event-outcome.html
+type EventOutcomeValue string
+
+const (
+	EventOutcomeFailure EventOutcomeValue = "failure"
+	EventOutcomeSuccess EventOutcomeValue = "success"
+	EventOutcomeUnknown EventOutcomeValue = "unknown"
+)
+
+// Internal lookup map for the allowed values of the event categorization fields
+var eventAllowedValuesMap = map[string]map[string]struct{}{
+	FieldEventKind: {
+		string(EventKindAlert): {}, string(EventKindAsset): {}, string(EventKindEnrichment): {}, string(EventKindEvent): {},
+		string(EventKindMetric): {}, string(EventKindState): {}, string(EventKindPipelineError): {}, string(EventKindSignal): {},
+	},
+	FieldEventCategory: {
+		string(EventCategoryAPI): {}, string(EventCategoryAuthentication): {}, string(EventCategoryConfiguration): {},
+		string(EventCategoryDatabase): {}, string(EventCategoryDriver): {}, string(EventCategoryEmail): {},
+		string(EventCategoryFile): {}, string(EventCategoryHost): {}, string(EventCategoryIAM): {},
+		string(EventCategoryIntrusionDetection): {}, string(EventCategoryLibrary): {}, string(EventCategoryMalware): {},
+		string(EventCategoryNetwork): {}, string(EventCategoryPackage): {}, string(EventCategoryProcess): {},
+		string(EventCategoryRegistry): {}, string(EventCategorySession): {}, string(EventCategoryThreat): {},
+		string(EventCategoryVulnerability): {}, string(EventCategoryWeb): {},
+	},
+	FieldEventType: {
+		string(EventTypeAccess): {}, string(EventTypeAdmin): {}, string(EventTypeAllowed): {}, string(EventTypeChange): {},
+		string(EventTypeConnection): {}, string(EventTypeCreation): {}, string(EventTypeDeletion): {}, string(EventTypeDenied): {},
+		string(EventTypeEnd): {}, string(EventTypeError): {}, string(EventTypeGroup): {}, string(EventTypeIndicator): {},
+		string(EventTypeInfo): {}, string(EventTypeInstallation): {}, string(EventTypeProtocol): {}, string(EventTypeStart): {},
+		string(EventTypeUser): {},
+	},
+	FieldEventOutcome: {
+		string(EventOutcomeFailure): {}, string(EventOutcomeSuccess): {}, string(EventOutcomeUnknown): {},
+	},
+}
+
+// ValidateEventField checks the value of the event categorization fields (event.kind,
+// event.category, event.type and event.outcome) against the ECS allowed values. Fields
+// with any other key are always valid
+func ValidateEventField(field zap.Field) error {
+	allowedValues, found := eventAllowedValuesMap[field.Key]
+	if !found {
+		return nil
+	}
+
+	for _, value := range fieldStringValues(field) {
+		if _, allowed := allowedValues[value]; !allowed {
+			return fmt.Errorf("ecs: %q is not an allowed value of %s", value, field.Key)
+		}
+	}
+	return nil
+}
+
+// fieldStringValues returns the string representation of the field value, flattening arrays
+func fieldStringValues(field zap.Field) []string {
+	if field.Type == zapcore.StringType {
+		return []string{field.String}
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+	switch value := enc.Fields[field.Key].(type) {
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
@@ -45,6 +45,11 @@ func Tags(val []string) zap.Field {
 	return zap.Field{Key: FieldTags, Type: zapcore.SkipType, Interface: val}
 }
 
+// Tag constructs a tags field from the given tags, as Tags does
+func Tag(tags ...string) zap.Field {
+	return Tags(tags)
+}
+
 // Duration constructs a field with the given key and value.
 func Duration(key string, val time.Duration) zap.Field {
 	// Don't use the duration field as its encoder translates to seconds only: https://github.com/uber-go/zap/issues/649
@@ -66,11 +71,30 @@ func EventKind(val string) zap.Field {
 	return zap.String(FieldEventKind, val)
 }
 
+// EventKindOf constructs a String field with the FieldEventKind ECS standard key from an allowed value
+func EventKindOf(val EventKindValue) zap.Field {
+	return zap.String(FieldEventKind, string(val))
+}
+
 // EventCategory constructs a String field with the FieldEventCategory ECS standard key
 func EventCategory(val string) zap.Field {
 	return zap.String(FieldEventCategory, val)
 }
 
+// EventCategoryOf constructs a String field with the FieldEventCategory ECS standard key from an allowed value
+func EventCategoryOf(val EventCategoryValue) zap.Field {
+	return zap.String(FieldEventCategory, string(val))
+}
+
+// EventCategories constructs a Strings field with the FieldEventCategory ECS standard key
+func EventCategories(vals ...EventCategoryValue) zap.Field {
+	categories := make([]string, 0, len(vals))
+	for _, val := range vals {
+		categories = append(categories, string(val))
+	}
+	return zap.Strings(FieldEventCategory, categories)
+}
+
 // EventModule constructs a String field with the FieldEventModule ECS standard key
 func EventModule(val string) zap.Field {
 	return zap.String(FieldEventModule, val)
@@ -81,6 +105,20 @@ func EventType(val string) zap.Field {
 	return zap.String(FieldEventType, val)
 }
 
+// EventTypeOf constructs a String field with the FieldEventType ECS standard key from an allowed value
+func EventTypeOf(val EventTypeValue) zap.Field {
+	return zap.String(FieldEventType, string(val))
+}
+
+// EventTypes constructs a Strings field with the FieldEventType ECS standard key
+func EventTypes(vals ...EventTypeValue) zap.Field {
+	types := make([]string, 0, len(vals))
+	for _, val := range vals {
+		types = append(types, string(val))
+	}
+	return zap.Strings(FieldEventType, types)
+}
+
 // EventOriginal constructs a String field with the FieldEventOriginal ECS standard key
 func EventOriginal(val string) zap.Field {
 	return zap.String(FieldEventOriginal, val)
@@ -91,11 +129,116 @@ func EventOutcome(val string) zap.Field {
 	return zap.String(FieldEventOutcome, val)
 }
 
+// EventOutcomeOf constructs a String field with the FieldEventOutcome ECS standard key from an allowed value
+func EventOutcomeOf(val EventOutcomeValue) zap.Field {
+	return zap.String(FieldEventOutcome, string(val))
+}
+
+// EventID constructs a String field with the FieldEventID ECS standard key
+func EventID(val string) zap.Field {
+	return zap.String(FieldEventID, val)
+}
+
+// EventCode constructs a String field with the FieldEventCode ECS standard key
+func EventCode(val string) zap.Field {
+	return zap.String(FieldEventCode, val)
+}
+
+// EventDuration constructs an Int64 field with the FieldEventDuration ECS standard key,
+// represented in nanoseconds as mandated by ECS
+func EventDuration(val time.Duration) zap.Field {
+	return zap.Int64(FieldEventDuration, val.Nanoseconds())
+}
+
+// EventStart constructs a Time field with the FieldEventStart ECS standard key
+func EventStart(val time.Time) zap.Field {
+	return zap.Time(FieldEventStart, val)
+}
+
+// EventEnd constructs a Time field with the FieldEventEnd ECS standard key
+func EventEnd(val time.Time) zap.Field {
+	return zap.Time(FieldEventEnd, val)
+}
+
+// EventCreated constructs a Time field with the FieldEventCreated ECS standard key
+func EventCreated(val time.Time) zap.Field {
+	return zap.Time(FieldEventCreated, val)
+}
+
+// EventIngested constructs a Time field with the FieldEventIngested ECS standard key
+func EventIngested(val time.Time) zap.Field {
+	return zap.Time(FieldEventIngested, val)
+}
+
+// EventSequence constructs an Int64 field with the FieldEventSequence ECS standard key
+func EventSequence(val int64) zap.Field {
+	return zap.Int64(FieldEventSequence, val)
+}
+
+// EventSeverity constructs an Int64 field with the FieldEventSeverity ECS standard key
+func EventSeverity(val int64) zap.Field {
+	return zap.Int64(FieldEventSeverity, val)
+}
+
+// EventRiskScore constructs a Float64 field with the FieldEventRiskScore ECS standard key
+func EventRiskScore(val float64) zap.Field {
+	return zap.Float64(FieldEventRiskScore, val)
+}
+
+// EventReason constructs a String field with the FieldEventReason ECS standard key
+func EventReason(val string) zap.Field {
+	return zap.String(FieldEventReason, val)
+}
+
+// EventReference constructs a String field with the FieldEventReference ECS standard key
+func EventReference(val string) zap.Field {
+	return zap.String(FieldEventReference, val)
+}
+
+// EventDataset constructs a String field with the FieldEventDataset ECS standard key
+func EventDataset(val string) zap.Field {
+	return zap.String(FieldEventDataset, val)
+}
+
+// EventProvider constructs a String field with the FieldEventProvider ECS standard key
+func EventProvider(val string) zap.Field {
+	return zap.String(FieldEventProvider, val)
+}
+
+// EventTimezone constructs a String field with the FieldEventTimezone ECS standard key
+func EventTimezone(val string) zap.Field {
+	return zap.String(FieldEventTimezone, val)
+}
+
+// EventHash constructs a String field with the FieldEventHash ECS standard key
+func EventHash(val string) zap.Field {
+	return zap.String(FieldEventHash, val)
+}
+
 // TraceID constructs a String field with the FieldTraceID ECS standard key
 func TraceID(val string) zap.Field {
 	return zap.String(FieldTraceID, val)
 }
 
+/*
+	LOG FIELDS
+*/
+
+// LogOriginFileName constructs a String field with the FieldLogOriginFileName ECS standard key
+func LogOriginFileName(val string) zap.Field {
+	return zap.String(FieldLogOriginFileName, val)
+}
+
+// LogOriginFileLine constructs an Int field with the FieldLogOriginFileLine ECS standard key
+func LogOriginFileLine(val int) zap.Field {
+	return zap.Int(FieldLogOriginFileLine, val)
+}
+
+// LogOriginFunction constructs a String field with the FieldLogOriginFunction ECS standard key
+func LogOriginFunction(val string) zap.Field {
+	return zap.String(FieldLogOriginFunction, val)
+}
+
 /*
 	ERROR FIELDS
 */
@@ -149,3 +292,301 @@ func HTTPResponseStatusCode(val string) zap.Field {
 func HTTPResponseBodyReferrer(val string) zap.Field {
 	return zap.String(FieldHTTPResponseBodyReferrer, val)
 }
+
+/*
+	DATA STREAM FIELDS
+*/
+
+// DataStreamType constructs a String field with the FieldDataStreamType ECS standard key
+func DataStreamType(val DataStreamTypeValue) zap.Field {
+	return zap.String(FieldDataStreamType, SanitizeDataStreamValue(FieldDataStreamType, string(val)))
+}
+
+// DataStreamDataset constructs a String field with the FieldDataStreamDataset ECS standard key,
+// sanitizing its value
+func DataStreamDataset(val string) zap.Field {
+	return zap.String(FieldDataStreamDataset, SanitizeDataStreamValue(FieldDataStreamDataset, val))
+}
+
+// DataStreamNamespace constructs a String field with the FieldDataStreamNamespace ECS standard
+// key, sanitizing its value
+func DataStreamNamespace(val string) zap.Field {
+	return zap.String(FieldDataStreamNamespace, SanitizeDataStreamValue(FieldDataStreamNamespace, val))
+}
+
+/*
+	PROCESS FIELDS
+*/
+
+// ProcessPID constructs an Int field with the FieldProcessPID ECS standard key
+func ProcessPID(val int) zap.Field {
+	return zap.Int(FieldProcessPID, val)
+}
+
+// ProcessPPID constructs an Int field with the FieldProcessPPID ECS standard key
+func ProcessPPID(val int) zap.Field {
+	return zap.Int(FieldProcessPPID, val)
+}
+
+// ProcessName constructs a String field with the FieldProcessName ECS standard key
+func ProcessName(val string) zap.Field {
+	return zap.String(FieldProcessName, val)
+}
+
+// ProcessExecutable constructs a String field with the FieldProcessExecutable ECS standard key
+func ProcessExecutable(val string) zap.Field {
+	return zap.String(FieldProcessExecutable, val)
+}
+
+// ProcessArgs constructs a Strings field with the FieldProcessArgs ECS standard key
+func ProcessArgs(val []string) zap.Field {
+	return zap.Strings(FieldProcessArgs, val)
+}
+
+// ProcessWorkingDirectory constructs a String field with the FieldProcessWorkingDirectory ECS standard key
+func ProcessWorkingDirectory(val string) zap.Field {
+	return zap.String(FieldProcessWorkingDirectory, val)
+}
+
+// ProcessStart constructs a Time field with the FieldProcessStart ECS standard key
+func ProcessStart(val time.Time) zap.Field {
+	return zap.Time(FieldProcessStart, val)
+}
+
+// ProcessEnd constructs a Time field with the FieldProcessEnd ECS standard key
+func ProcessEnd(val time.Time) zap.Field {
+	return zap.Time(FieldProcessEnd, val)
+}
+
+// ProcessExitCode constructs an Int field with the FieldProcessExitCode ECS standard key
+func ProcessExitCode(val int) zap.Field {
+	return zap.Int(FieldProcessExitCode, val)
+}
+
+// ProcessThreadID constructs an Int64 field with the FieldProcessThreadID ECS standard key
+func ProcessThreadID(val int64) zap.Field {
+	return zap.Int64(FieldProcessThreadID, val)
+}
+
+// ProcessTitle constructs a String field with the FieldProcessTitle ECS standard key
+func ProcessTitle(val string) zap.Field {
+	return zap.String(FieldProcessTitle, val)
+}
+
+/*
+	CONTAINER FIELDS
+*/
+
+// ContainerID constructs a String field with the FieldContainerID ECS standard key
+func ContainerID(val string) zap.Field {
+	return zap.String(FieldContainerID, val)
+}
+
+// ContainerName constructs a String field with the FieldContainerName ECS standard key
+func ContainerName(val string) zap.Field {
+	return zap.String(FieldContainerName, val)
+}
+
+// ContainerRuntime constructs a String field with the FieldContainerRuntime ECS standard key
+func ContainerRuntime(val string) zap.Field {
+	return zap.String(FieldContainerRuntime, val)
+}
+
+// ContainerImageName constructs a String field with the FieldContainerImageName ECS standard key
+func ContainerImageName(val string) zap.Field {
+	return zap.String(FieldContainerImageName, val)
+}
+
+// ContainerImageTag constructs a Strings field with the FieldContainerImageTag ECS standard key
+func ContainerImageTag(val []string) zap.Field {
+	return zap.Strings(FieldContainerImageTag, val)
+}
+
+/*
+	ORCHESTRATOR FIELDS
+*/
+
+// OrchestratorType constructs a String field with the FieldOrchestratorType ECS standard key
+func OrchestratorType(val string) zap.Field {
+	return zap.String(FieldOrchestratorType, val)
+}
+
+// OrchestratorNamespace constructs a String field with the FieldOrchestratorNamespace ECS standard key
+func OrchestratorNamespace(val string) zap.Field {
+	return zap.String(FieldOrchestratorNamespace, val)
+}
+
+// OrchestratorResourceName constructs a String field with the FieldOrchestratorResourceName ECS standard key
+func OrchestratorResourceName(val string) zap.Field {
+	return zap.String(FieldOrchestratorResourceName, val)
+}
+
+// OrchestratorResourceType constructs a String field with the FieldOrchestratorResourceType ECS standard key
+func OrchestratorResourceType(val string) zap.Field {
+	return zap.String(FieldOrchestratorResourceType, val)
+}
+
+/*
+	KUBERNETES FIELDS
+*/
+
+// KubernetesNamespace constructs a String field with the FieldKubernetesNamespace key
+func KubernetesNamespace(val string) zap.Field {
+	return zap.String(FieldKubernetesNamespace, val)
+}
+
+// KubernetesNodeName constructs a String field with the FieldKubernetesNodeName key
+func KubernetesNodeName(val string) zap.Field {
+	return zap.String(FieldKubernetesNodeName, val)
+}
+
+// KubernetesPodName constructs a String field with the FieldKubernetesPodName key
+func KubernetesPodName(val string) zap.Field {
+	return zap.String(FieldKubernetesPodName, val)
+}
+
+// KubernetesPodUID constructs a String field with the FieldKubernetesPodUID key
+func KubernetesPodUID(val string) zap.Field {
+	return zap.String(FieldKubernetesPodUID, val)
+}
+
+// KubernetesPodIP constructs a String field with the FieldKubernetesPodIP key
+func KubernetesPodIP(val string) zap.Field {
+	return zap.String(FieldKubernetesPodIP, val)
+}
+
+/*
+	CLOUD FIELDS
+*/
+
+// CloudProvider constructs a String field with the FieldCloudProvider ECS standard key
+func CloudProvider(val string) zap.Field {
+	return zap.String(FieldCloudProvider, val)
+}
+
+// CloudRegion constructs a String field with the FieldCloudRegion ECS standard key
+func CloudRegion(val string) zap.Field {
+	return zap.String(FieldCloudRegion, val)
+}
+
+// CloudAvailabilityZone constructs a String field with the FieldCloudAvailabilityZone ECS standard key
+func CloudAvailabilityZone(val string) zap.Field {
+	return zap.String(FieldCloudAvailabilityZone, val)
+}
+
+// CloudAccountID constructs a String field with the FieldCloudAccountID ECS standard key
+func CloudAccountID(val string) zap.Field {
+	return zap.String(FieldCloudAccountID, val)
+}
+
+// CloudInstanceID constructs a String field with the FieldCloudInstanceID ECS standard key
+func CloudInstanceID(val string) zap.Field {
+	return zap.String(FieldCloudInstanceID, val)
+}
+
+// CloudInstanceName constructs a String field with the FieldCloudInstanceName ECS standard key
+func CloudInstanceName(val string) zap.Field {
+	return zap.String(FieldCloudInstanceName, val)
+}
+
+// CloudMachineType constructs a String field with the FieldCloudMachineType ECS standard key
+func CloudMachineType(val string) zap.Field {
+	return zap.String(FieldCloudMachineType, val)
+}
+
+// CloudServiceName constructs a String field with the FieldCloudServiceName ECS standard key
+func CloudServiceName(val string) zap.Field {
+	return zap.String(FieldCloudServiceName, val)
+}
+
+// CloudProjectID constructs a String field with the FieldCloudProjectID ECS standard key
+func CloudProjectID(val string) zap.Field {
+	return zap.String(FieldCloudProjectID, val)
+}
+
+/*
+	USER FIELDS
+*/
+
+// UserID constructs a String field with the FieldUserID ECS standard key
+func UserID(val string) zap.Field {
+	return zap.String(FieldUserID, val)
+}
+
+// UserName constructs a String field with the FieldUserName ECS standard key
+func UserName(val string) zap.Field {
+	return zap.String(FieldUserName, val)
+}
+
+// UserFullName constructs a String field with the FieldUserFullName ECS standard key
+func UserFullName(val string) zap.Field {
+	return zap.String(FieldUserFullName, val)
+}
+
+// UserEmail constructs a String field with the FieldUserEmail ECS standard key
+func UserEmail(val string) zap.Field {
+	return zap.String(FieldUserEmail, val)
+}
+
+// UserDomain constructs a String field with the FieldUserDomain ECS standard key
+func UserDomain(val string) zap.Field {
+	return zap.String(FieldUserDomain, val)
+}
+
+// UserRoles constructs a Strings field with the FieldUserRoles ECS standard key
+func UserRoles(val []string) zap.Field {
+	return zap.Strings(FieldUserRoles, val)
+}
+
+// UserHash constructs a String field with the FieldUserHash ECS standard key
+func UserHash(val string) zap.Field {
+	return zap.String(FieldUserHash, val)
+}
+
+// UserGroupID constructs a String field with the FieldUserGroupID ECS standard key
+func UserGroupID(val string) zap.Field {
+	return zap.String(FieldUserGroupID, val)
+}
+
+// UserGroupName constructs a String field with the FieldUserGroupName ECS standard key
+func UserGroupName(val string) zap.Field {
+	return zap.String(FieldUserGroupName, val)
+}
+
+// UserGroupDomain constructs a String field with the FieldUserGroupDomain ECS standard key
+func UserGroupDomain(val string) zap.Field {
+	return zap.String(FieldUserGroupDomain, val)
+}
+
+/*
+	GROUP FIELDS
+*/
+
+// GroupID constructs a String field with the FieldGroupID ECS standard key
+func GroupID(val string) zap.Field {
+	return zap.String(FieldGroupID, val)
+}
+
+// GroupName constructs a String field with the FieldGroupName ECS standard key
+func GroupName(val string) zap.Field {
+	return zap.String(FieldGroupName, val)
+}
+
+// GroupDomain constructs a String field with the FieldGroupDomain ECS standard key
+func GroupDomain(val string) zap.Field {
+	return zap.String(FieldGroupDomain, val)
+}
+
+/*
+	ORGANIZATION FIELDS
+*/
+
+// OrganizationID constructs a String field with the FieldOrganizationID ECS standard key
+func OrganizationID(val string) zap.Field {
+	return zap.String(FieldOrganizationID, val)
+}
+
+// OrganizationName constructs a String field with the FieldOrganizationName ECS standard key
+func OrganizationName(val string) zap.Field {
+	return zap.String(FieldOrganizationName, val)
+}
@@ -0,0 +1,218 @@
+package ecs
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	orchestratorTypeKubernetes = "kubernetes"
+	orchestratorResourcePod    = "pod"
+
+	cgroupPath             = "/proc/self/cgroup"
+	mountInfoPath          = "/proc/self/mountinfo"
+	serviceAccountNSPath   = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	kubernetesServiceHost  = "KUBERNETES_SERVICE_HOST"
+	containerImageTagDelim = ":"
+)
+
+// Downward API environment variable names, in order of precedence. The MY_ prefixed
+// variants are kept for compatibility with the former FieldLabelPodName/FieldLabelNodeName setup
+var (
+	podNameEnvVars       = []string{"POD_NAME", "MY_POD_NAME", "KUBERNETES_POD_NAME"}
+	podNamespaceEnvVars  = []string{"POD_NAMESPACE", "MY_POD_NAMESPACE", "KUBERNETES_NAMESPACE"}
+	podUIDEnvVars        = []string{"POD_UID", "MY_POD_UID", "KUBERNETES_POD_UID"}
+	podIPEnvVars         = []string{"POD_IP", "MY_POD_IP", "KUBERNETES_POD_IP"}
+	nodeNameEnvVars      = []string{"NODE_NAME", "MY_NODE_NAME", "KUBERNETES_NODE_NAME"}
+	containerNameEnvVars = []string{"CONTAINER_NAME", "MY_CONTAINER_NAME"}
+	containerImgEnvVars  = []string{"CONTAINER_IMAGE", "MY_CONTAINER_IMAGE"}
+)
+
+var (
+	containerIDRegexp = regexp.MustCompile(`[0-9a-f]{64}`)
+	podUIDRegexp      = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+	// Container runtime identifiers as found on cgroup paths, in order of precedence
+	containerRuntimes = []string{"containerd", "crio", "docker"}
+)
+
+// KubernetesDetector gathers container and kubernetes metadata from the downward API
+// environment variables, the process cgroups and the pod service account
+type KubernetesDetector struct {
+	// Root is the filesystem root the procfs and service account files are read from.
+	// Empty means "/"
+	Root string
+	// Getenv looks up environment variables. Nil means os.Getenv
+	Getenv func(key string) string
+}
+
+// DetectKubernetes returns the container, orchestrator and kubernetes field sets of the running
+// process, suitable to be used as base labels of the logger
+func DetectKubernetes() []zap.Field {
+	return KubernetesDetector{}.Detect()
+}
+
+// Detect returns the detected container, orchestrator and kubernetes fields. Metadata that
+// could not be detected is omitted
+func (d KubernetesDetector) Detect() []zap.Field {
+	fields := make([]zap.Field, 0, 14)
+	fields = append(fields, d.detectContainer()...)
+
+	podName := d.lookupEnv(podNameEnvVars)
+	namespace := d.lookupEnv(podNamespaceEnvVars)
+	if namespace == "" {
+		namespace = d.readFile(serviceAccountNSPath)
+	}
+	if podName == "" && namespace == "" && d.getenv(kubernetesServiceHost) == "" {
+		// Not running on kubernetes
+		return fields
+	}
+	if podName == "" {
+		// The pod hostname defaults to its name
+		podName = d.getenv("HOSTNAME")
+	}
+
+	fields = append(fields, OrchestratorType(orchestratorTypeKubernetes))
+	if namespace != "" {
+		fields = append(fields, OrchestratorNamespace(namespace), KubernetesNamespace(namespace))
+	}
+	if podName != "" {
+		fields = append(fields,
+			OrchestratorResourceType(orchestratorResourcePod),
+			OrchestratorResourceName(podName),
+			KubernetesPodName(podName))
+	}
+
+	podUID := d.lookupEnv(podUIDEnvVars)
+	if podUID == "" {
+		podUID = d.detectPodUID()
+	}
+	if podUID != "" {
+		fields = append(fields, KubernetesPodUID(podUID))
+	}
+	if podIP := d.lookupEnv(podIPEnvVars); podIP != "" {
+		fields = append(fields, KubernetesPodIP(podIP))
+	}
+	if nodeName := d.lookupEnv(nodeNameEnvVars); nodeName != "" {
+		fields = append(fields, KubernetesNodeName(nodeName))
+	}
+
+	return fields
+}
+
+func (d KubernetesDetector) detectContainer() []zap.Field {
+	fields := make([]zap.Field, 0, 5)
+
+	cgroups := d.readFile(cgroupPath)
+	containerID := containerIDRegexp.FindString(lastCgroupPath(cgroups))
+	if containerID == "" {
+		// cgroup v2 namespaces hide the container path, fall back to its mounts
+		containerID = containerIDFromMountInfo(d.readFile(mountInfoPath))
+	}
+	if containerID != "" {
+		fields = append(fields, ContainerID(containerID))
+		for _, runtime := range containerRuntimes {
+			if strings.Contains(cgroups, runtime) {
+				fields = append(fields, ContainerRuntime(runtime))
+				break
+			}
+		}
+	}
+
+	if name := d.lookupEnv(containerNameEnvVars); name != "" {
+		fields = append(fields, ContainerName(name))
+	}
+	if image := d.lookupEnv(containerImgEnvVars); image != "" {
+		name, tag := splitImageReference(image)
+		fields = append(fields, ContainerImageName(name))
+		if tag != "" {
+			fields = append(fields, ContainerImageTag([]string{tag}))
+		}
+	}
+
+	return fields
+}
+
+func (d KubernetesDetector) detectPodUID() string {
+	match := podUIDRegexp.FindStringSubmatch(d.readFile(cgroupPath))
+	if len(match) < 2 {
+		return ""
+	}
+	// systemd cgroup drivers escape the uid dashes as underscores
+	return strings.ReplaceAll(match[1], "_", "-")
+}
+
+func (d KubernetesDetector) getenv(key string) string {
+	if d.Getenv != nil {
+		return d.Getenv(key)
+	}
+	return os.Getenv(key)
+}
+
+func (d KubernetesDetector) lookupEnv(keys []string) string {
+	for _, key := range keys {
+		if val := strings.TrimSpace(d.getenv(key)); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+func (d KubernetesDetector) readFile(path string) string {
+	root := d.Root
+	if root == "" {
+		root = string(filepath.Separator)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// lastCgroupPath returns the innermost cgroup path that references a container id
+func lastCgroupPath(cgroups string) string {
+	path := ""
+	scanner := bufio.NewScanner(strings.NewReader(cgroups))
+	for scanner.Scan() {
+		// Lines are formatted as hierarchy-ID:controller-list:cgroup-path
+		tokens := strings.SplitN(scanner.Text(), ":", 3)
+		if len(tokens) == 3 && containerIDRegexp.MatchString(tokens[2]) {
+			path = tokens[2]
+		}
+	}
+	return path
+}
+
+func containerIDFromMountInfo(mountInfo string) string {
+	scanner := bufio.NewScanner(strings.NewReader(mountInfo))
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, "/containers/")
+		if idx < 0 {
+			continue
+		}
+		if id := containerIDRegexp.FindString(line[idx:]); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// splitImageReference splits an image reference into its name and tag, ignoring digests
+func splitImageReference(image string) (name, tag string) {
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		image = image[:idx]
+	}
+	// The tag delimiter must come after the last path separator, as registries may have ports
+	idx := strings.LastIndex(image, containerImageTagDelim)
+	if idx < 0 || idx < strings.LastIndex(image, "/") {
+		return image, ""
+	}
+	return image[:idx], image[idx+1:]
+}
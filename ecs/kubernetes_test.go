@@ -0,0 +1,134 @@
+package ecs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const testContainerID = "2f4a3bb9b3c0e1ed1c33d4d5e8c7f1f3a1b2c3d4e5f60718293a4b5c6d7e8f90"
+
+// fieldsAsMap encodes the fields into a flat key/value map for assertions
+func fieldsAsMap(fields []zap.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+func writeFakeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	fullPath := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fullPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_KubernetesDetector(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		env      map[string]string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "no_container",
+			files:    map[string]string{cgroupPath: "0::/user.slice/user-1000.slice/session-2.scope\n"},
+			expected: map[string]interface{}{},
+		},
+		{
+			name:  "docker_cgroup_v1",
+			files: map[string]string{cgroupPath: "12:pids:/docker/" + testContainerID + "\n11:memory:/docker/" + testContainerID + "\n"},
+			env:   map[string]string{"CONTAINER_IMAGE": "registry.local:5000/acme/api:1.2.3"},
+			expected: map[string]interface{}{
+				FieldContainerID:        testContainerID,
+				FieldContainerRuntime:   "docker",
+				FieldContainerImageName: "registry.local:5000/acme/api",
+				FieldContainerImageTag:  []interface{}{"1.2.3"},
+			},
+		},
+		{
+			name:  "docker_cgroup_v2_mountinfo",
+			files: map[string]string{cgroupPath: "0::/\n", mountInfoPath: "1 2 0:1 /docker/containers/" + testContainerID + "/hostname /etc/hostname rw - ext4 /dev/sda1 rw\n"},
+			expected: map[string]interface{}{
+				FieldContainerID: testContainerID,
+			},
+		},
+		{
+			name: "kubernetes_downward_api",
+			files: map[string]string{
+				cgroupPath:           "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod7d3f1a2b_4c5d_6e7f_8a9b_0c1d2e3f4a5b.slice/cri-containerd-" + testContainerID + ".scope\n",
+				serviceAccountNSPath: "from-file\n",
+			},
+			env: map[string]string{
+				"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+				"MY_POD_NAME":             "api-6d4cf56db6-abcde",
+				"POD_NAMESPACE":           "production",
+				"POD_IP":                  "10.1.2.3",
+				"NODE_NAME":               "node-1",
+				"CONTAINER_NAME":          "api",
+				"CONTAINER_IMAGE":         "acme/api@sha256:0123",
+			},
+			expected: map[string]interface{}{
+				FieldContainerID:              testContainerID,
+				FieldContainerRuntime:         "containerd",
+				FieldContainerName:            "api",
+				FieldContainerImageName:       "acme/api",
+				FieldOrchestratorType:         "kubernetes",
+				FieldOrchestratorNamespace:    "production",
+				FieldOrchestratorResourceType: "pod",
+				FieldOrchestratorResourceName: "api-6d4cf56db6-abcde",
+				FieldKubernetesNamespace:      "production",
+				FieldKubernetesPodName:        "api-6d4cf56db6-abcde",
+				FieldKubernetesPodUID:         "7d3f1a2b-4c5d-6e7f-8a9b-0c1d2e3f4a5b",
+				FieldKubernetesPodIP:          "10.1.2.3",
+				FieldKubernetesNodeName:       "node-1",
+			},
+		},
+		{
+			name:  "kubernetes_service_account",
+			files: map[string]string{serviceAccountNSPath: "default\n"},
+			env:   map[string]string{"HOSTNAME": "worker-0"},
+			expected: map[string]interface{}{
+				FieldOrchestratorType:         "kubernetes",
+				FieldOrchestratorNamespace:    "default",
+				FieldOrchestratorResourceType: "pod",
+				FieldOrchestratorResourceName: "worker-0",
+				FieldKubernetesNamespace:      "default",
+				FieldKubernetesPodName:        "worker-0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "zap-ecs-kubernetes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			for path, content := range tt.files {
+				writeFakeFile(t, root, path, content)
+			}
+
+			detector := KubernetesDetector{
+				Root:   root,
+				Getenv: func(key string) string { return tt.env[key] },
+			}
+			actual := fieldsAsMap(detector.Detect())
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("unexpected fields:\n\texpected: %v\n\tactual:   %v", tt.expected, actual)
+			}
+		})
+	}
+}
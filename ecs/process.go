@@ -0,0 +1,93 @@
+package ecs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CurrentProcess returns the process field set describing the running binary, suitable to be
+// used as base labels of the logger. The start time is only included where the OS exposes it
+// (linux), while the thread id is left out, as it changes between the entries
+func CurrentProcess() []zap.Field {
+	fields := make([]zap.Field, 0, 8)
+	fields = append(fields,
+		ProcessPID(os.Getpid()),
+		ProcessPPID(os.Getppid()),
+		ProcessArgs(os.Args))
+	if start, ok := currentProcessStart(); ok {
+		fields = append(fields, ProcessStart(start))
+	}
+
+	name := ""
+	if executable, err := os.Executable(); err == nil {
+		name = filepath.Base(executable)
+		fields = append(fields, ProcessExecutable(executable))
+	} else if len(os.Args) > 0 {
+		name = filepath.Base(os.Args[0])
+	}
+	if name != "" {
+		fields = append(fields, ProcessName(name))
+	}
+
+	if wd, err := os.Getwd(); err == nil {
+		fields = append(fields, ProcessWorkingDirectory(wd))
+	}
+	if title := currentProcessTitle(); title != "" {
+		fields = append(fields, ProcessTitle(title))
+	} else if name != "" {
+		fields = append(fields, ProcessTitle(name))
+	}
+	return fields
+}
+
+// ProcessFromCmd returns the process field set describing the child process of cmd. If the
+// command has already finished, its exit code is included as well, but not its end time, which
+// is unknown to cmd (see ProcessFromState)
+func ProcessFromCmd(cmd *exec.Cmd) []zap.Field {
+	if cmd == nil {
+		return nil
+	}
+
+	fields := make([]zap.Field, 0, 9)
+	fields = append(fields, ProcessPPID(os.Getpid()))
+	if cmd.Path != "" {
+		fields = append(fields,
+			ProcessExecutable(cmd.Path),
+			ProcessName(filepath.Base(cmd.Path)))
+	}
+	if len(cmd.Args) > 0 {
+		fields = append(fields, ProcessArgs(cmd.Args))
+	}
+	if cmd.Dir != "" {
+		fields = append(fields, ProcessWorkingDirectory(cmd.Dir))
+	}
+
+	if cmd.ProcessState != nil {
+		fields = append(fields, ProcessFromState(cmd.ProcessState, time.Time{})...)
+	} else if cmd.Process != nil {
+		fields = append(fields, ProcessPID(cmd.Process.Pid))
+	}
+
+	return fields
+}
+
+// ProcessFromState returns the process fields describing an exited process: its pid, exit
+// code and end time, such as the time its Wait returned. A zero end time is omitted
+func ProcessFromState(state *os.ProcessState, end time.Time) []zap.Field {
+	if state == nil {
+		return nil
+	}
+
+	fields := []zap.Field{
+		ProcessPID(state.Pid()),
+		ProcessExitCode(state.ExitCode()),
+	}
+	if !end.IsZero() {
+		fields = append(fields, ProcessEnd(end))
+	}
+	return fields
+}
@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+package ecs
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procClockTicks is the USER_HZ unit of the procfs times, which is fixed to 100 on the
+// supported architectures
+const procClockTicks = 100
+
+// procStatStartTimeField is the index of the starttime field of /proc/self/stat, counted from
+// the state field following the command name
+const procStatStartTimeField = 19
+
+// currentProcessStart returns the process start time, from its start time since boot
+// (/proc/self/stat) and the boot time (/proc/stat)
+func currentProcessStart() (time.Time, bool) {
+	stat, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	// The command name is enclosed in parentheses and may contain spaces
+	idx := bytes.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(string(stat[idx+1:]))
+	if len(fields) <= procStatStartTimeField {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[procStatStartTimeField], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	bootTime, ok := bootTime()
+	if !ok {
+		return time.Time{}, false
+	}
+	return bootTime.Add(time.Duration(ticks) * time.Second / procClockTicks), true
+}
+
+// bootTime returns the system boot time, from the btime line of /proc/stat
+func bootTime() (time.Time, bool) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "btime" {
+			seconds, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.Unix(seconds, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// currentProcessTitle returns the process title as exposed by procfs
+func currentProcessTitle() string {
+	data, err := ioutil.ReadFile("/proc/self/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package ecs
+
+import "time"
+
+// currentProcessStart is not supported outside linux
+func currentProcessStart() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// currentProcessTitle is not supported outside linux
+func currentProcessTitle() string {
+	return ""
+}
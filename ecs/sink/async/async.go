@@ -0,0 +1,370 @@
+// Package async provides a zapcore.Core that writes the encoded entries to its WriteSyncer in
+// the background, so that a stalled sink does not block the logger consumers
+package async
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultBufferSize    = 1024
+	defaultFlushInterval = time.Second
+	defaultFlushTimeout  = 5 * time.Second
+
+	droppedAction = "log-entries-dropped"
+)
+
+var (
+	// ErrClosed is returned when writing to a closed core
+	ErrClosed = errors.New("async: core is closed")
+	// ErrFlushTimeout is returned when the buffered entries are not drained within the flush timeout
+	ErrFlushTimeout = errors.New("async: flush timed out")
+)
+
+// OverflowPolicy determines what happens to the entries written while the buffer is full.
+// Entries above the error level are never dropped, but block until there is room
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the writers until there is room in the buffer
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the entries being written
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest buffered entries to make room for the new ones
+	OverflowDropOldest
+	// OverflowDropBelowLevel drops the entries being written below DropLevel, while the rest block
+	OverflowDropBelowLevel
+)
+
+// Config holds the core settings. Zero values are replaced by their defaults
+type Config struct {
+	// BufferSize is the number of entries buffered. Defaults to 1024
+	BufferSize int
+	// Overflow is the policy applied to the entries written while the buffer is full
+	Overflow OverflowPolicy
+	// DropLevel is the level below which entries are dropped by OverflowDropBelowLevel
+	DropLevel zapcore.Level
+	// FlushInterval is the interval of the periodic syncs of the WriteSyncer and the reports of
+	// the dropped entries. Defaults to 1s
+	FlushInterval time.Duration
+	// FlushTimeout is the time Sync waits for the buffered entries to be written. Defaults to 5s
+	FlushTimeout time.Duration
+}
+
+// Core is a zapcore.Core encoding the entries on write, as their fields may be reused
+// afterwards, and writing them in the background through a bounded ring buffer. The number
+// of dropped entries is reported periodically as an ECS event.kind=metric entry
+type Core struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *writer
+}
+
+// bufferedEntry is an encoded entry waiting to be written
+type bufferedEntry struct {
+	level zapcore.Level
+	buf   *buffer.Buffer
+}
+
+// writer holds the ring buffer and worker shared by a core and its children
+type writer struct {
+	// Counters go first to keep them 64-bit aligned
+	dropped     uint64
+	reported    uint64
+	writeErrors uint64
+
+	cfg Config
+	ws  zapcore.WriteSyncer
+	enc zapcore.Encoder
+
+	mu      sync.Mutex
+	notFull *sync.Cond
+	ring    []bufferedEntry
+	head    int
+	count   int
+	closed  bool
+
+	// writeErr is the last WriteSyncer write error since the previous sync. It is only
+	// accessed by the worker
+	writeErr error
+
+	wake    chan struct{}
+	flushes chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewCore returns a core encoding the entries with enc and writing them to ws in the
+// background, and starts its worker
+func NewCore(enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler, cfg Config) *Core {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = defaultFlushTimeout
+	}
+
+	w := &writer{
+		cfg:     cfg,
+		ws:      ws,
+		enc:     enc.Clone(),
+		ring:    make([]bufferedEntry, cfg.BufferSize),
+		wake:    make(chan struct{}, 1),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+	go w.run()
+
+	return &Core{LevelEnabler: enab, enc: enc, w: w}
+}
+
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return &Core{LevelEnabler: c.LevelEnabler, enc: enc, w: c.w}
+}
+
+func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write encodes the entry and buffers it. Entries above the error level are never dropped by
+// the overflow policy and are written synchronously, since the process may exit right after
+func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	if err = c.w.push(bufferedEntry{level: ent.Level, buf: buf}); err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+// Sync writes the buffered entries and syncs the WriteSyncer, waiting up to the flush timeout.
+// It returns the sync error, if any, or else the last write error since the previous sync
+func (c *Core) Sync() error {
+	return c.w.flush()
+}
+
+// Close writes the buffered entries and stops the worker, returning the errors as Sync does.
+// Subsequent writes fail with ErrClosed
+func (c *Core) Close() error {
+	return c.w.close()
+}
+
+// Dropped returns the number of entries dropped due to a full buffer
+func (c *Core) Dropped() uint64 {
+	return atomic.LoadUint64(&c.w.dropped)
+}
+
+// WriteErrors returns the number of entries (including the dropped entries reports) that the
+// WriteSyncer failed to write
+func (c *Core) WriteErrors() uint64 {
+	return atomic.LoadUint64(&c.w.writeErrors)
+}
+
+// push adds the entry to the ring buffer, applying the overflow policy if it is full. Entries
+// above the error level wait for room instead of being dropped
+func (w *writer) push(e bufferedEntry) error {
+	droppable := e.level <= zapcore.ErrorLevel
+	w.mu.Lock()
+	for !w.closed && w.count == len(w.ring) {
+		switch {
+		case droppable && w.cfg.Overflow == OverflowDropNewest,
+			droppable && w.cfg.Overflow == OverflowDropBelowLevel && e.level < w.cfg.DropLevel:
+			w.mu.Unlock()
+			e.buf.Free()
+			atomic.AddUint64(&w.dropped, 1)
+			return nil
+		case w.cfg.Overflow == OverflowDropOldest:
+			oldest := w.ring[w.head]
+			w.ring[w.head] = bufferedEntry{}
+			w.head = (w.head + 1) % len(w.ring)
+			w.count--
+			oldest.buf.Free()
+			atomic.AddUint64(&w.dropped, 1)
+		default:
+			w.notFull.Wait()
+		}
+	}
+	if w.closed {
+		w.mu.Unlock()
+		e.buf.Free()
+		return ErrClosed
+	}
+	w.ring[(w.head+w.count)%len(w.ring)] = e
+	w.count++
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop removes the buffered entries, appending them to entries
+func (w *writer) pop(entries []bufferedEntry) []bufferedEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ; w.count > 0; w.count-- {
+		entries = append(entries, w.ring[w.head])
+		w.ring[w.head] = bufferedEntry{}
+		w.head = (w.head + 1) % len(w.ring)
+	}
+	w.notFull.Broadcast()
+	return entries
+}
+
+func (w *writer) flush() error {
+	reply := make(chan error, 1)
+	timeout := time.NewTimer(w.cfg.FlushTimeout)
+	defer timeout.Stop()
+
+	select {
+	case w.flushes <- reply:
+	case <-w.stopped:
+		return nil
+	case <-timeout.C:
+		return ErrFlushTimeout
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-timeout.C:
+		return ErrFlushTimeout
+	}
+}
+
+func (w *writer) close() error {
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.notFull.Broadcast()
+		w.mu.Unlock()
+		close(w.done)
+	})
+	<-w.stopped
+	return w.closeErr
+}
+
+// run writes the buffered entries until the core is closed
+func (w *writer) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var entries []bufferedEntry
+	for {
+		select {
+		case <-w.wake:
+			entries = w.drain(entries)
+		case <-ticker.C:
+			entries = w.drain(entries)
+			w.report()
+			_ = w.ws.Sync()
+		case reply := <-w.flushes:
+			entries = w.drain(entries)
+			w.report()
+			reply <- w.sync()
+		case <-w.done:
+			entries = w.drain(entries)
+			w.report()
+			w.closeErr = w.sync()
+			return
+		}
+	}
+}
+
+// drain writes the buffered entries, reusing the given slice
+func (w *writer) drain(entries []bufferedEntry) []bufferedEntry {
+	for {
+		entries = w.pop(entries[:0])
+		if len(entries) == 0 {
+			return entries
+		}
+		for i, e := range entries {
+			w.write(e.buf.Bytes())
+			e.buf.Free()
+			entries[i] = bufferedEntry{}
+		}
+	}
+}
+
+// report writes an ECS metric event with the number of entries dropped since the last report
+func (w *writer) report() {
+	dropped := atomic.LoadUint64(&w.dropped)
+	count := dropped - w.reported
+	if count == 0 {
+		return
+	}
+	w.reported = dropped
+
+	buf, err := w.enc.EncodeEntry(zapcore.Entry{
+		Level:   zapcore.WarnLevel,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("dropped %d log entries due to a full buffer", count),
+	}, []zapcore.Field{
+		zap.Object(ecs.EventBaseLevelKey, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("kind", string(ecs.EventKindMetric))
+			enc.AddString("action", droppedAction)
+			enc.AddString("outcome", string(ecs.EventOutcomeFailure))
+			return nil
+		})),
+		zap.Object(ecs.FieldLabels, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddUint64("dropped_entries", count)
+			return nil
+		})),
+	})
+	if err != nil {
+		return
+	}
+	w.write(buf.Bytes())
+	buf.Free()
+}
+
+// write writes an encoded entry, counting and keeping the error until the next sync
+func (w *writer) write(b []byte) {
+	if _, err := w.ws.Write(b); err != nil {
+		atomic.AddUint64(&w.writeErrors, 1)
+		w.writeErr = err
+	}
+}
+
+// sync syncs the WriteSyncer, returning its error or else the last write error
+func (w *writer) sync() error {
+	writeErr := w.writeErr
+	w.writeErr = nil
+	if err := w.ws.Sync(); err != nil {
+		return err
+	}
+	return writeErr
+}
@@ -0,0 +1,286 @@
+package async
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	zapEcs "github.com/lggomez/zap-ecs"
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// stalledSink blocks its writes until released, signaling the first one
+type stalledSink struct {
+	mu       sync.Mutex
+	lines    []string
+	started  chan struct{}
+	release  chan struct{}
+	startOne sync.Once
+}
+
+func newStalledSink(stalled bool) *stalledSink {
+	s := &stalledSink{started: make(chan struct{}), release: make(chan struct{})}
+	if !stalled {
+		close(s.release)
+	}
+	return s
+}
+
+func (s *stalledSink) Write(p []byte) (int, error) {
+	s.startOne.Do(func() { close(s.started) })
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+func (s *stalledSink) Sync() error {
+	return nil
+}
+
+// messages returns the messages of the written entries
+func (s *stalledSink) messages(t *testing.T) []string {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]string, len(s.lines))
+	for i, line := range s.lines {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		messages[i], _ = entry["message"].(string)
+	}
+	return messages
+}
+
+func newTestCore(t *testing.T, sink *stalledSink, cfg Config) *Core {
+	t.Helper()
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "message", LevelKey: "level", EncodeLevel: zapcore.LowercaseLevelEncoder})
+	core := NewCore(enc, sink, zap.DebugLevel, cfg)
+	t.Cleanup(func() { _ = core.Close() })
+	return core
+}
+
+func write(t *testing.T, core *Core, lvl zapcore.Level, messages ...string) {
+	t.Helper()
+	for _, msg := range messages {
+		if err := core.Write(zapcore.Entry{Level: lvl, Message: msg}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func Test_CoreOverflow(t *testing.T) {
+	report := "dropped 1 log entries due to a full buffer"
+	tests := []struct {
+		name     string
+		cfg      Config
+		overflow func(t *testing.T, core *Core)
+		expected []string
+		dropped  uint64
+	}{
+		{
+			name: "drop_newest",
+			cfg:  Config{Overflow: OverflowDropNewest},
+			overflow: func(t *testing.T, core *Core) {
+				write(t, core, zap.ErrorLevel, "entry 4")
+			},
+			expected: []string{"entry 1", "entry 2", "entry 3", report},
+			dropped:  1,
+		},
+		{
+			name: "drop_newest_panic",
+			cfg:  Config{Overflow: OverflowDropNewest},
+			overflow: func(t *testing.T, core *Core) {
+				go func() { _ = core.Write(zapcore.Entry{Level: zap.PanicLevel, Message: "entry 4"}, nil) }()
+			},
+			expected: []string{"entry 1", "entry 2", "entry 3", "entry 4"},
+		},
+		{
+			name: "drop_below_level_panic",
+			cfg:  Config{Overflow: OverflowDropBelowLevel, DropLevel: zap.FatalLevel},
+			overflow: func(t *testing.T, core *Core) {
+				go func() { _ = core.Write(zapcore.Entry{Level: zap.DPanicLevel, Message: "entry 4"}, nil) }()
+			},
+			expected: []string{"entry 1", "entry 2", "entry 3", "entry 4"},
+		},
+		{
+			name: "drop_oldest",
+			cfg:  Config{Overflow: OverflowDropOldest},
+			overflow: func(t *testing.T, core *Core) {
+				write(t, core, zap.InfoLevel, "entry 4")
+			},
+			expected: []string{"entry 1", "entry 3", "entry 4", report},
+			dropped:  1,
+		},
+		{
+			name: "drop_below_level",
+			cfg:  Config{Overflow: OverflowDropBelowLevel, DropLevel: zap.WarnLevel},
+			overflow: func(t *testing.T, core *Core) {
+				write(t, core, zap.InfoLevel, "entry 4")
+				go func() { _ = core.Write(zapcore.Entry{Level: zap.ErrorLevel, Message: "entry 5"}, nil) }()
+			},
+			expected: []string{"entry 1", "entry 2", "entry 3", "entry 5", report},
+			dropped:  1,
+		},
+		{
+			name: "block",
+			cfg:  Config{Overflow: OverflowBlock},
+			overflow: func(t *testing.T, core *Core) {
+				go func() { _ = core.Write(zapcore.Entry{Level: zap.InfoLevel, Message: "entry 4"}, nil) }()
+			},
+			expected: []string{"entry 1", "entry 2", "entry 3", "entry 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt.cfg.BufferSize = 2
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newStalledSink(true)
+			core := newTestCore(t, sink, tt.cfg)
+
+			// The worker is blocked on the first entry, so the next two fill the buffer
+			write(t, core, zap.InfoLevel, "entry 1")
+			<-sink.started
+			write(t, core, zap.InfoLevel, "entry 2", "entry 3")
+			tt.overflow(t, core)
+
+			// Let the blocked writers reach the full buffer before releasing the sink
+			time.Sleep(20 * time.Millisecond)
+			close(sink.release)
+			deadline := time.Now().Add(time.Second)
+			for len(sink.messages(t)) < len(tt.expected) && time.Now().Before(deadline) {
+				if err := core.Sync(); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			// Unblocked writers race with the dropped entries report, so the order is not checked
+			got := sink.messages(t)
+			sort.Strings(got)
+			sort.Strings(tt.expected)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			if got := core.Dropped(); got != tt.dropped {
+				t.Fatalf("expected %d dropped entries, got %d", tt.dropped, got)
+			}
+		})
+	}
+}
+
+func Test_CoreDroppedReport(t *testing.T) {
+	sink := newStalledSink(true)
+	core := newTestCore(t, sink, Config{BufferSize: 1, Overflow: OverflowDropNewest})
+
+	write(t, core, zap.InfoLevel, "entry 1")
+	<-sink.started
+	write(t, core, zap.InfoLevel, "entry 2", "entry 3", "entry 4")
+	close(sink.release)
+	if err := core.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sink.mu.Lock()
+	report := sink.lines[len(sink.lines)-1]
+	sink.mu.Unlock()
+	expected := `{"level":"warn","message":"dropped 2 log entries due to a full buffer",` +
+		`"event":{"kind":"metric","action":"log-entries-dropped","outcome":"failure"},"labels":{"dropped_entries":2}}`
+	if report != expected {
+		t.Fatalf("expected %v, got %v", expected, report)
+	}
+}
+
+func Test_CoreFlushTimeout(t *testing.T) {
+	sink := newStalledSink(true)
+	core := newTestCore(t, sink, Config{FlushTimeout: 10 * time.Millisecond})
+
+	write(t, core, zap.InfoLevel, "entry 1")
+	<-sink.started
+	if err := core.Sync(); err != ErrFlushTimeout {
+		t.Fatalf("expected %v, got %v", ErrFlushTimeout, err)
+	}
+
+	close(sink.release)
+	if err := core.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := core.Write(zapcore.Entry{Message: "entry 2"}, nil); err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+}
+
+// failingSink fails its writes
+type failingSink struct {
+	err error
+}
+
+func (s failingSink) Write([]byte) (int, error) {
+	return 0, s.err
+}
+
+func (s failingSink) Sync() error {
+	return nil
+}
+
+func Test_CoreWriteErrors(t *testing.T) {
+	writeErr := errors.New("disk full")
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "message"})
+	core := NewCore(enc, failingSink{err: writeErr}, zap.DebugLevel, Config{})
+
+	write(t, core, zap.InfoLevel, "entry 1", "entry 2")
+	if err := core.Sync(); err != writeErr {
+		t.Fatalf("expected %v, got %v", writeErr, err)
+	}
+	if got := core.WriteErrors(); got != 2 {
+		t.Fatalf("expected 2 write errors, got %d", got)
+	}
+	// The error is returned once
+	if err := core.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	write(t, core, zap.InfoLevel, "entry 3")
+	if err := core.Close(); err != writeErr {
+		t.Fatalf("expected %v, got %v", writeErr, err)
+	}
+	if got := core.WriteErrors(); got != 3 {
+		t.Fatalf("expected 3 write errors, got %d", got)
+	}
+}
+
+func Test_CoreECSLogger(t *testing.T) {
+	sink := newStalledSink(false)
+	core := newTestCore(t, sink, Config{})
+	l := zapEcs.NewECSLogger(zapEcs.Options{Logger: zap.New(core)})
+
+	// Entries are encoded before their pooled fields are reused by the next ones
+	for i := 0; i < 100; i++ {
+		l.Info(fmt.Sprintf("entry %d", i), ecs.EventAction(fmt.Sprintf("action-%d", i)))
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.lines) != 100 {
+		t.Fatalf("expected 100 entries, got %d", len(sink.lines))
+	}
+	for i, line := range sink.lines {
+		if expected := fmt.Sprintf(`"event":{"action":"action-%d"}`, i); !strings.Contains(line, expected) {
+			t.Fatalf("expected %v in %v", expected, line)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Package elasticsearch provides a zapcore.WriteSyncer that ships the log entries to an
+// Elasticsearch data stream through the _bulk API
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lggomez/zap-ecs/ecs"
+)
+
+const (
+	defaultFlushBytes    = 5 * 1024 * 1024
+	defaultFlushInterval = 5 * time.Second
+	defaultQueueSize     = 4096
+	defaultMaxRetries    = 3
+	defaultRetryBackoff  = 100 * time.Millisecond
+	defaultFlushTimeout  = 30 * time.Second
+	// defaultRequestTimeout bounds the bulk requests of the default client
+	defaultRequestTimeout = 10 * time.Second
+
+	// createAction is the bulk action of each document, as data streams are append only
+	createAction = `{"create":{}}` + "\n"
+)
+
+var (
+	// ErrClosed is returned when writing to a closed sink
+	ErrClosed = errors.New("elasticsearch: sink is closed")
+	// ErrFlushTimeout is returned by Sync when the queued documents are not sent within the flush
+	// timeout. They are still sent in the background
+	ErrFlushTimeout = errors.New("elasticsearch: flush timed out")
+)
+
+// Config holds the sink settings. Zero values are replaced by their defaults
+type Config struct {
+	// URL is the Elasticsearch base URL, such as http://localhost:9200
+	URL string
+	// DataStream is the target data stream, such as logs-myservice-default
+	DataStream string
+	// RouteByDataStream sends each document with data_stream.* fields to the data stream named
+	// after them by ecs.DataStreamName, instead of DataStream
+	RouteByDataStream bool
+	// Client performs the bulk requests. Defaults to a client with a 10s timeout
+	Client *http.Client
+	// Header is added to the bulk requests, such as the Authorization header
+	Header http.Header
+	// FlushBytes is the batch size that triggers a flush. Defaults to 5MB
+	FlushBytes int
+	// FlushInterval is the maximum time between flushes. Defaults to 5s
+	FlushInterval time.Duration
+	// QueueSize is the number of documents waiting to be batched, beyond which they are dropped.
+	// Defaults to 4096
+	QueueSize int
+	// MaxRetries is the number of retries of the requests and documents rejected with a 429 or
+	// 5xx status. Defaults to 3
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled on each subsequent one.
+	// Defaults to 100ms
+	RetryBackoff time.Duration
+	// FlushTimeout is the time Sync waits for the queued documents to be sent, retries included.
+	// Defaults to 30s
+	FlushTimeout time.Duration
+	// ErrorHandler receives the errors of the background flushes, which are discarded otherwise
+	ErrorHandler func(error)
+}
+
+// Stats holds the document counters of the sink
+type Stats struct {
+	// Indexed is the number of documents indexed
+	Indexed uint64
+	// Failed is the number of documents rejected, or whose retries were exhausted
+	Failed uint64
+	// Dropped is the number of documents dropped due to a full queue
+	Dropped uint64
+}
+
+// Sink is a zapcore.WriteSyncer batching the written documents (one per line) into bulk
+// requests. Writes never block: documents are queued and sent by a background worker, while
+// Sync flushes the pending ones
+type Sink struct {
+	// Counters go first to keep them 64-bit aligned
+	indexed uint64
+	failed  uint64
+	dropped uint64
+
+	cfg     Config
+	bulkURL string
+	queue   chan []byte
+	flushes chan chan error
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+	closeErr  error
+}
+
+// batch accumulates the documents of the next bulk request
+type batch struct {
+	docs [][]byte
+	size int
+}
+
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+type bulkItem struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// New returns a sink writing to the configured data stream, and starts its worker
+func New(cfg Config) (*Sink, error) {
+	if cfg.URL == "" || cfg.DataStream == "" {
+		return nil, errors.New("elasticsearch: URL and DataStream are required")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: defaultRequestTimeout}
+	}
+	if cfg.FlushBytes <= 0 {
+		cfg.FlushBytes = defaultFlushBytes
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = defaultFlushTimeout
+	}
+
+	s := &Sink{
+		cfg:     cfg,
+		bulkURL: strings.TrimSuffix(cfg.URL, "/") + "/" + cfg.DataStream + "/_bulk",
+		queue:   make(chan []byte, cfg.QueueSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write queues each line of p as a document. Documents are dropped if the queue is full
+func (s *Sink) Write(p []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, ErrClosed
+	default:
+	}
+
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		// The encoder buffer is reused after Write returns, so the document must be copied
+		doc := make([]byte, len(line))
+		copy(doc, line)
+		select {
+		case s.queue <- doc:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+	return len(p), nil
+}
+
+// Sync flushes the queued documents, returning the errors of the bulk request. It waits up to
+// the flush timeout, returning ErrFlushTimeout past it
+func (s *Sink) Sync() error {
+	reply := make(chan error, 1)
+	timeout := time.NewTimer(s.cfg.FlushTimeout)
+	defer timeout.Stop()
+
+	select {
+	case s.flushes <- reply:
+	case <-s.stopped:
+		return nil
+	case <-timeout.C:
+		return ErrFlushTimeout
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-timeout.C:
+		return ErrFlushTimeout
+	}
+}
+
+// Flush flushes the queued documents, as Sync does
+func (s *Sink) Flush() error {
+	return s.Sync()
+}
+
+// Close flushes the queued documents and stops the worker. Subsequent writes fail with ErrClosed
+func (s *Sink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+	return s.closeErr
+}
+
+// Stats returns the document counters of the sink
+func (s *Sink) Stats() Stats {
+	return Stats{
+		Indexed: atomic.LoadUint64(&s.indexed),
+		Failed:  atomic.LoadUint64(&s.failed),
+		Dropped: atomic.LoadUint64(&s.dropped),
+	}
+}
+
+// run batches the queued documents until the sink is closed
+func (s *Sink) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	b := &batch{}
+	for {
+		select {
+		case doc := <-s.queue:
+			b.add(doc)
+			if b.size >= s.cfg.FlushBytes {
+				s.handleError(s.flush(b))
+			}
+		case <-ticker.C:
+			s.handleError(s.flush(b))
+		case reply := <-s.flushes:
+			s.drain(b)
+			reply <- s.flush(b)
+		case <-s.done:
+			s.drain(b)
+			s.closeErr = s.flush(b)
+			return
+		}
+	}
+}
+
+// drain moves the queued documents to the batch, flushing it whenever it is full
+func (s *Sink) drain(b *batch) {
+	for {
+		select {
+		case doc := <-s.queue:
+			b.add(doc)
+			if b.size >= s.cfg.FlushBytes {
+				s.handleError(s.flush(b))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *Sink) handleError(err error) {
+	if err != nil && s.cfg.ErrorHandler != nil {
+		s.cfg.ErrorHandler(err)
+	}
+}
+
+func (b *batch) add(doc []byte) {
+	b.docs = append(b.docs, doc)
+	b.size += len(createAction) + len(doc) + 1
+}
+
+func (b *batch) reset() {
+	for i := range b.docs {
+		b.docs[i] = nil
+	}
+	b.docs = b.docs[:0]
+	b.size = 0
+}
+
+// flush sends the batch, retrying the rejected documents with exponential backoff. It returns
+// the first failure of the documents that were not indexed
+func (s *Sink) flush(b *batch) error {
+	if len(b.docs) == 0 {
+		return nil
+	}
+	defer b.reset()
+
+	docs := b.docs
+	backoff := s.cfg.RetryBackoff
+	var failure error
+	for attempt := 0; ; attempt++ {
+		retry, retryReason, err := s.send(docs)
+		if failure == nil {
+			failure = err
+		}
+		if len(retry) == 0 {
+			return failure
+		}
+		if attempt == s.cfg.MaxRetries {
+			atomic.AddUint64(&s.failed, uint64(len(retry)))
+			if failure == nil {
+				failure = fmt.Errorf("elasticsearch: %d documents failed after %d retries: %v", len(retry), attempt, retryReason)
+			}
+			return failure
+		}
+		docs = retry
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send performs a bulk request with the documents, returning the ones to be retried along with
+// the reason, and the failure of the ones that were rejected
+func (s *Sink) send(docs [][]byte) (retry [][]byte, retryReason, err error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		body.WriteString(s.action(doc))
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.bulkURL, &body)
+	if err != nil {
+		atomic.AddUint64(&s.failed, uint64(len(docs)))
+		return nil, nil, fmt.Errorf("elasticsearch: %w", err)
+	}
+	for key, values := range s.cfg.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return docs, fmt.Errorf("elasticsearch: bulk request failed: %w", err), nil
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return docs, fmt.Errorf("elasticsearch: bulk request failed with status %d", resp.StatusCode), nil
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		atomic.AddUint64(&s.failed, uint64(len(docs)))
+		return nil, nil, fmt.Errorf("elasticsearch: bulk request failed with status %d", resp.StatusCode)
+	}
+
+	var result bulkResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		// The request succeeded, so its documents are not retried to avoid duplicates
+		atomic.AddUint64(&s.indexed, uint64(len(docs)))
+		return nil, nil, fmt.Errorf("elasticsearch: invalid bulk response: %w", err)
+	}
+	if !result.Errors {
+		atomic.AddUint64(&s.indexed, uint64(len(docs)))
+		return nil, nil, nil
+	}
+	return s.itemErrors(docs, result.Items)
+}
+
+// dataStreamDoc holds the data stream fields of a document, either nested or dotted
+type dataStreamDoc struct {
+	DataStream struct {
+		Type      string `json:"type"`
+		Dataset   string `json:"dataset"`
+		Namespace string `json:"namespace"`
+	} `json:"data_stream"`
+	Type      string `json:"data_stream.type"`
+	Dataset   string `json:"data_stream.dataset"`
+	Namespace string `json:"data_stream.namespace"`
+}
+
+// action returns the bulk action of the document, targeting the data stream named after its
+// fields if RouteByDataStream is set
+func (s *Sink) action(doc []byte) string {
+	if !s.cfg.RouteByDataStream {
+		return createAction
+	}
+	var d dataStreamDoc
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return createAction
+	}
+	typ, dataset, namespace := firstNonEmpty(d.DataStream.Type, d.Type), firstNonEmpty(d.DataStream.Dataset, d.Dataset),
+		firstNonEmpty(d.DataStream.Namespace, d.Namespace)
+	if typ == "" && dataset == "" && namespace == "" {
+		return createAction
+	}
+
+	index, err := json.Marshal(ecs.DataStreamName(ecs.DataStreamTypeValue(typ), dataset, namespace))
+	if err != nil {
+		return createAction
+	}
+	return `{"create":{"_index":` + string(index) + "}}\n"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// itemErrors counts the outcome of each document of a bulk response with errors, returning
+// the documents to be retried and the first failure of the rejected ones
+func (s *Sink) itemErrors(docs [][]byte, items []map[string]bulkItem) (retry [][]byte, retryReason, err error) {
+	for i, doc := range docs {
+		var item bulkItem
+		if i < len(items) {
+			item = actionItem(items[i])
+		}
+		switch {
+		case item.Status >= http.StatusOK && item.Status < http.StatusMultipleChoices:
+			atomic.AddUint64(&s.indexed, 1)
+		case item.Status == http.StatusTooManyRequests || item.Status >= http.StatusInternalServerError:
+			retry = append(retry, doc)
+			retryReason = itemError(item)
+		default:
+			atomic.AddUint64(&s.failed, 1)
+			if err == nil {
+				err = itemError(item)
+			}
+		}
+	}
+	return retry, retryReason, err
+}
+
+// actionItem returns the result of a bulk response item, which is keyed by its action
+func actionItem(item map[string]bulkItem) bulkItem {
+	for _, result := range item {
+		return result
+	}
+	return bulkItem{}
+}
+
+func itemError(item bulkItem) error {
+	if item.Error == nil {
+		return fmt.Errorf("elasticsearch: document failed with status %d", item.Status)
+	}
+	return fmt.Errorf("elasticsearch: document failed with status %d: %s: %s", item.Status, item.Error.Type, item.Error.Reason)
+}
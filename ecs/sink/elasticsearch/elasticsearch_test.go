@@ -0,0 +1,314 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkServer mimics the Elasticsearch _bulk API, replying to each request with the item
+// statuses returned by the respond function (nil for a successful response)
+type bulkServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests [][]string
+	actions  []string
+	respond  func(request int, docs []string) (status int, items []int)
+}
+
+func newBulkServer(t *testing.T, respond func(request int, docs []string) (int, []int)) *bulkServer {
+	t.Helper()
+	s := &bulkServer{respond: respond}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/logs-test-default/_bulk" ||
+			r.Header.Get("Content-Type") != "application/x-ndjson" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var docs, actions []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			action := scanner.Text()
+			if !strings.HasPrefix(action, `{"create":{`) || !scanner.Scan() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			actions = append(actions, action)
+			docs = append(docs, scanner.Text())
+		}
+
+		s.mu.Lock()
+		request := len(s.requests)
+		s.requests = append(s.requests, docs)
+		s.actions = append(s.actions, actions...)
+		s.mu.Unlock()
+
+		status, items := http.StatusOK, []int(nil)
+		if s.respond != nil {
+			status, items = s.respond(request, docs)
+		}
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			return
+		}
+		if items == nil {
+			_, _ = fmt.Fprint(w, `{"errors":false,"items":[]}`)
+			return
+		}
+		results := make([]string, len(items))
+		for i, itemStatus := range items {
+			result := fmt.Sprintf(`{"create":{"status":%d}}`, itemStatus)
+			if itemStatus >= http.StatusMultipleChoices {
+				result = fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`, itemStatus)
+			}
+			results[i] = result
+		}
+		_, _ = fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(results, ","))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *bulkServer) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.requests...)
+}
+
+func newTestSink(t *testing.T, server *bulkServer, cfg Config) *Sink {
+	t.Helper()
+	cfg.URL = server.URL
+	cfg.DataStream = "logs-test-default"
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = time.Millisecond
+	}
+	sink, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = sink.Close() })
+	return sink
+}
+
+func writeDocs(t *testing.T, sink *Sink, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := fmt.Fprintf(sink, "{\"message\":\"doc %d\"}\n", i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func assertStats(t *testing.T, sink *Sink, expected Stats) {
+	t.Helper()
+	if got := sink.Stats(); got != expected {
+		t.Fatalf("expected stats %+v, got %+v", expected, got)
+	}
+}
+
+func Test_SinkSync(t *testing.T) {
+	server := newBulkServer(t, nil)
+	sink := newTestSink(t, server, Config{})
+
+	writeDocs(t, sink, 3)
+	if err := sink.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := server.received()
+	if len(requests) != 1 || len(requests[0]) != 3 || requests[0][2] != `{"message":"doc 2"}` {
+		t.Fatalf("expected a single bulk request with 3 documents, got %v", requests)
+	}
+	assertStats(t, sink, Stats{Indexed: 3})
+
+	// Nothing is sent when there are no pending documents
+	if err := sink.Sync(); err != nil || len(server.received()) != 1 {
+		t.Fatalf("expected no requests, got %v (%v)", server.received(), err)
+	}
+}
+
+func Test_SinkFlushBytes(t *testing.T) {
+	server := newBulkServer(t, nil)
+	sink := newTestSink(t, server, Config{FlushBytes: 1})
+
+	writeDocs(t, sink, 3)
+	if err := sink.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests := server.received(); len(requests) != 3 {
+		t.Fatalf("expected a bulk request per document, got %v", requests)
+	}
+	assertStats(t, sink, Stats{Indexed: 3})
+}
+
+func Test_SinkFlushInterval(t *testing.T) {
+	server := newBulkServer(t, nil)
+	sink := newTestSink(t, server, Config{FlushInterval: 10 * time.Millisecond})
+
+	writeDocs(t, sink, 2)
+	deadline := time.Now().Add(time.Second)
+	for len(server.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the documents to be flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if requests := server.received(); len(requests[0]) != 2 {
+		t.Fatalf("expected a bulk request with 2 documents, got %v", requests)
+	}
+}
+
+func Test_SinkRetries(t *testing.T) {
+	server := newBulkServer(t, func(request int, _ []string) (int, []int) {
+		if request < 2 {
+			return http.StatusTooManyRequests, nil
+		}
+		return http.StatusOK, nil
+	})
+	sink := newTestSink(t, server, Config{})
+
+	writeDocs(t, sink, 3)
+	if err := sink.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests := server.received(); len(requests) != 3 || len(requests[2]) != 3 {
+		t.Fatalf("expected 2 retries of the 3 documents, got %v", requests)
+	}
+	assertStats(t, sink, Stats{Indexed: 3})
+}
+
+func Test_SinkRetriesExhausted(t *testing.T) {
+	server := newBulkServer(t, func(int, []string) (int, []int) {
+		return http.StatusServiceUnavailable, nil
+	})
+	sink := newTestSink(t, server, Config{MaxRetries: 2})
+
+	writeDocs(t, sink, 3)
+	err := sink.Sync()
+	if err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Fatalf("expected a 503 error, got %v", err)
+	}
+	if requests := server.received(); len(requests) != 3 {
+		t.Fatalf("expected 2 retries, got %v", requests)
+	}
+	assertStats(t, sink, Stats{Failed: 3})
+}
+
+func Test_SinkItemErrors(t *testing.T) {
+	server := newBulkServer(t, func(request int, docs []string) (int, []int) {
+		if request == 0 {
+			return http.StatusOK, []int{http.StatusCreated, http.StatusBadRequest, http.StatusTooManyRequests, http.StatusServiceUnavailable}
+		}
+		return http.StatusOK, nil
+	})
+	sink := newTestSink(t, server, Config{})
+
+	writeDocs(t, sink, 4)
+	err := sink.Sync()
+	if err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Fatalf("expected the rejected document error, got %v", err)
+	}
+
+	// Only the documents rejected with a 429 or 5xx status are retried
+	requests := server.received()
+	if expected := []string{`{"message":"doc 2"}`, `{"message":"doc 3"}`}; len(requests) != 2 || !reflect.DeepEqual(requests[1], expected) {
+		t.Fatalf("expected a retry of the last two documents, got %v", requests)
+	}
+	assertStats(t, sink, Stats{Indexed: 3, Failed: 1})
+}
+
+func Test_SinkFlushTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := newBulkServer(t, func(request int, _ []string) (int, []int) {
+		if request == 0 {
+			close(started)
+			<-release
+		}
+		return http.StatusOK, nil
+	})
+	sink := newTestSink(t, server, Config{FlushTimeout: 10 * time.Millisecond})
+
+	// The default client bounds the requests as well
+	if sink.cfg.Client.Timeout != defaultRequestTimeout {
+		t.Fatalf("expected a client timeout of %v, got %v", defaultRequestTimeout, sink.cfg.Client.Timeout)
+	}
+
+	writeDocs(t, sink, 1)
+	if err := sink.Flush(); err != ErrFlushTimeout {
+		t.Fatalf("expected %v, got %v", ErrFlushTimeout, err)
+	}
+	<-started
+
+	// The documents are still sent in the background
+	close(release)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStats(t, sink, Stats{Indexed: 1})
+}
+
+func Test_SinkQueueFull(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := newBulkServer(t, func(request int, _ []string) (int, []int) {
+		if request == 0 {
+			close(started)
+			<-release
+		}
+		return http.StatusOK, nil
+	})
+	sink := newTestSink(t, server, Config{FlushBytes: 1, QueueSize: 1})
+
+	// The worker is blocked on the first request, so the second document fills the queue
+	writeDocs(t, sink, 1)
+	<-started
+	writeDocs(t, sink, 2)
+	assertStats(t, sink, Stats{Dropped: 1})
+
+	close(release)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStats(t, sink, Stats{Indexed: 2, Dropped: 1})
+
+	if _, err := sink.Write([]byte("{}\n")); err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+}
+
+func Test_SinkRouteByDataStream(t *testing.T) {
+	server := newBulkServer(t, nil)
+	sink := newTestSink(t, server, Config{RouteByDataStream: true})
+
+	for _, doc := range []string{
+		`{"message":"no data stream"}`,
+		`{"message":"nested","data_stream":{"type":"logs","dataset":"myservice.audit","namespace":"production"}}`,
+		`{"message":"dotted","data_stream.dataset":"myservice.access"}`,
+		`{"message":"invalid","data_stream":{"dataset":"My-Service"}}`,
+	} {
+		if _, err := fmt.Fprintln(sink, doc); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := sink.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`{"create":{}}`,
+		`{"create":{"_index":"logs-myservice.audit-production"}}`,
+		`{"create":{"_index":"logs-myservice.access-default"}}`,
+		`{"create":{"_index":"logs-my_service-default"}}`,
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !reflect.DeepEqual(server.actions, expected) {
+		t.Fatalf("expected actions %v, got %v", expected, server.actions)
+	}
+}
@@ -0,0 +1,363 @@
+// Package file provides a zapcore.WriteSyncer that writes the log entries to a file, rotating
+// it by size and age in a way that log shippers such as Filebeat or the Elastic Agent can follow
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxSize  = 100 * 1024 * 1024
+	defaultFileMode = 0644
+
+	// backupTimeLayout names the backups after their rotation time, so that they sort
+	// chronologically
+	backupTimeLayout = "20060102T150405.000"
+	compressedSuffix = ".gz"
+)
+
+// ErrClosed is returned when writing to a closed sink
+var ErrClosed = errors.New("file: sink is closed")
+
+// Config holds the sink settings. Zero values are replaced by their defaults
+type Config struct {
+	// Filename is the path of the active log file
+	Filename string
+	// MaxSize is the size in bytes beyond which the file is rotated. Defaults to 100MB
+	MaxSize int64
+	// MaxAge is the age of the file beyond which it is rotated. Zero disables age rotation
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept. Zero keeps all of them
+	MaxBackups int
+	// Compress gzip-compresses the rotated files but the newest one, which is compressed on the
+	// next rotation so that shippers can finish reading it
+	Compress bool
+	// FileMode is the mode of the created files. Defaults to 0644
+	FileMode os.FileMode
+	// ReopenOnSIGHUP reopens the file when the process receives a SIGHUP signal, for external
+	// rotation tools such as logrotate
+	ReopenOnSIGHUP bool
+}
+
+// Sink is a zapcore.WriteSyncer writing to a file that is rotated by renaming it to
+// <name>-<time><ext> and creating a new one. Renaming keeps the inode of the rotated file, so
+// shippers following it finish reading it before moving to the new one. It is safe for
+// concurrent use
+type Sink struct {
+	cfg    Config
+	now    func() time.Time
+	rename func(oldpath, newpath string) error
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	// Compression and cleanup of the backups run in the background, one rotation at a time
+	millMu sync.Mutex
+	millWG sync.WaitGroup
+
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// New opens (or creates) the configured file for appending
+func New(cfg Config) (*Sink, error) {
+	if cfg.Filename == "" {
+		return nil, errors.New("file: Filename is required")
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultMaxSize
+	}
+	if cfg.FileMode == 0 {
+		cfg.FileMode = defaultFileMode
+	}
+
+	s := &Sink{cfg: cfg, now: time.Now, rename: os.Rename, done: make(chan struct{})}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	if cfg.ReopenOnSIGHUP {
+		s.signals = make(chan os.Signal, 1)
+		signal.Notify(s.signals, syscall.SIGHUP)
+		go s.handleSignals()
+	}
+	return s, nil
+}
+
+// Write writes p to the file, rotating it beforehand if it would exceed the max size or is
+// older than the max age. If the rotation fails, p is written anyway and the rotation error is
+// returned, while the rotation is retried once the file grows by the max size or the max age
+// elapses again
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+	var rotateErr error
+	if s.size > 0 && (s.size+int64(len(p)) > s.cfg.MaxSize ||
+		s.cfg.MaxAge > 0 && s.now().Sub(s.openedAt) >= s.cfg.MaxAge) {
+		rotateErr = s.rotate()
+	}
+
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	if rotateErr != nil {
+		return n, rotateErr
+	}
+	return n, err
+}
+
+// Sync commits the file contents to disk
+func (s *Sink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Rotate rotates the file regardless of its size and age
+func (s *Sink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	return s.rotate()
+}
+
+// Reopen closes and reopens the file, which may have been moved by an external tool
+func (s *Sink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	return s.open()
+}
+
+// Close closes the file, waiting for the pending compression and cleanup of the backups
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.file.Close()
+	s.mu.Unlock()
+
+	if s.signals != nil {
+		signal.Stop(s.signals)
+	}
+	close(s.done)
+	s.millWG.Wait()
+	return err
+}
+
+func (s *Sink) handleSignals() {
+	for {
+		select {
+		case <-s.signals:
+			_ = s.Reopen()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// open opens the file for appending, creating its directory if needed
+func (s *Sink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.cfg.Filename), 0755); err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	f, err := os.OpenFile(s.cfg.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, s.cfg.FileMode)
+	if err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("file: %w", err)
+	}
+	s.file, s.size, s.openedAt = f, info.Size(), s.now()
+	return nil
+}
+
+// rotate renames the file to its backup name and creates a new one. The caller must hold mu
+func (s *Sink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	backup := s.backupName(s.now())
+	renameErr := s.rename(s.cfg.Filename, backup)
+	// The file is reopened even if it could not be renamed, so that it remains writable
+	if err := s.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		// Count the size from now on, so that the rotation is not retried on every write
+		s.size = 0
+		return fmt.Errorf("file: %w", renameErr)
+	}
+
+	s.millWG.Add(1)
+	go s.mill()
+	return nil
+}
+
+// backupName returns the name of a backup rotated at t. The time is increased on collisions,
+// so that backup names remain unique and chronological
+func (s *Sink) backupName(t time.Time) string {
+	dir, prefix, ext := s.backupParts()
+	for {
+		name := filepath.Join(dir, prefix+t.UTC().Format(backupTimeLayout)+ext)
+		if !exists(name) && !exists(name+compressedSuffix) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// backupParts splits the file name into its directory, backup prefix and extension
+func (s *Sink) backupParts() (dir, prefix, ext string) {
+	dir, name := filepath.Split(s.cfg.Filename)
+	ext = filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext) + "-", ext
+}
+
+// mill removes the backups beyond the max and then compresses the remaining ones but the
+// newest one if configured, as shippers may still be reading it
+func (s *Sink) mill() {
+	defer s.millWG.Done()
+	s.millMu.Lock()
+	defer s.millMu.Unlock()
+
+	if s.cfg.MaxBackups > 0 {
+		_ = s.removeOldBackups()
+	}
+	if s.cfg.Compress {
+		_ = s.compressBackups()
+	}
+}
+
+// compressBackups compresses the uncompressed backups, except the newest one
+func (s *Sink) compressBackups() error {
+	dir, backups, err := s.backups()
+	if err != nil || len(backups) == 0 {
+		return err
+	}
+	for _, name := range backups[:len(backups)-1] {
+		if strings.HasSuffix(name, compressedSuffix) {
+			continue
+		}
+		if err = compress(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeOldBackups removes the oldest backups beyond the max
+func (s *Sink) removeOldBackups() error {
+	dir, backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) <= s.cfg.MaxBackups {
+		return nil
+	}
+
+	for _, name := range backups[:len(backups)-s.cfg.MaxBackups] {
+		if err = os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// backups returns the directory of the backups and their names, compressed or not, from the
+// oldest to the newest
+func (s *Sink) backups() (string, []string, error) {
+	dir, prefix, ext := s.backupParts()
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp := strings.TrimPrefix(strings.TrimSuffix(strings.TrimSuffix(name, compressedSuffix), ext), prefix)
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || len(stamp) != len(backupTimeLayout) {
+			continue
+		}
+		if _, err = time.Parse(backupTimeLayout, stamp); err == nil {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	return dir, backups, nil
+}
+
+// compress gzips the file into <name>.gz and removes it
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+compressedSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(name + compressedSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
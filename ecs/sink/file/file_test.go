@@ -0,0 +1,261 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestSink(t *testing.T, cfg Config) (*Sink, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "zap-ecs-file")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	cfg.Filename = filepath.Join(dir, "logs", "app.log")
+	sink, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = sink.Close() })
+	return sink, filepath.Dir(cfg.Filename)
+}
+
+func write(t *testing.T, sink *Sink, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := sink.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// backups returns the sorted names of the rotated files in dir
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() != "app.log" {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readFile returns the contents of the file, decompressing it if needed
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.HasSuffix(name, compressedSuffix) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if data, err = ioutil.ReadAll(gz); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return string(data)
+}
+
+func Test_SinkRotateBySize(t *testing.T) {
+	sink, dir := newTestSink(t, Config{MaxSize: 16})
+
+	write(t, sink, "entry 1", "entry 2", "entry 3")
+	names := backups(t, dir)
+	if len(names) != 1 || !strings.HasPrefix(names[0], "app-") || !strings.HasSuffix(names[0], ".log") {
+		t.Fatalf("expected a single backup, got %v", names)
+	}
+	if got := readFile(t, filepath.Join(dir, names[0])); got != "entry 1\nentry 2\n" {
+		t.Fatalf("unexpected backup contents %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.log")); got != "entry 3\n" {
+		t.Fatalf("unexpected file contents %q", got)
+	}
+}
+
+func Test_SinkRotateByAge(t *testing.T) {
+	now := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+	sink, dir := newTestSink(t, Config{MaxAge: time.Hour})
+	sink.now = func() time.Time { return now }
+	sink.openedAt = now
+
+	write(t, sink, "entry 1")
+	now = now.Add(30 * time.Minute)
+	write(t, sink, "entry 2")
+	if names := backups(t, dir); len(names) != 0 {
+		t.Fatalf("expected no backups, got %v", names)
+	}
+
+	now = now.Add(30 * time.Minute)
+	write(t, sink, "entry 3")
+	if names := backups(t, dir); len(names) != 1 || names[0] != "app-19901126T185611.000.log" {
+		t.Fatalf("expected a backup named after the rotation time, got %v", names)
+	}
+}
+
+func Test_SinkRotateRenameError(t *testing.T) {
+	sink, dir := newTestSink(t, Config{MaxSize: 16})
+	renameErr := syscall.EXDEV
+	sink.rename = func(string, string) error { return renameErr }
+
+	// The entry is written even though the rotation failed
+	write(t, sink, "entry 1", "entry 2")
+	if n, err := sink.Write([]byte("entry 3\n")); n != 8 || !errors.Is(err, renameErr) {
+		t.Fatalf("expected the entry to be written along with the rename error, got %d, %v", n, err)
+	}
+
+	// The rotation is not retried until the file grows by the max size again
+	write(t, sink, "entry 4")
+	if got := readFile(t, filepath.Join(dir, "app.log")); got != "entry 1\nentry 2\nentry 3\nentry 4\n" {
+		t.Fatalf("unexpected file contents %q", got)
+	}
+
+	sink.rename = os.Rename
+	write(t, sink, "entry 5")
+	names := backups(t, dir)
+	if len(names) != 1 || readFile(t, filepath.Join(dir, names[0])) != "entry 1\nentry 2\nentry 3\nentry 4\n" {
+		t.Fatalf("expected the rotation to be retried, got %v", names)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.log")); got != "entry 5\n" {
+		t.Fatalf("unexpected file contents %q", got)
+	}
+}
+
+func Test_SinkInodeSafeRotation(t *testing.T) {
+	sink, dir := newTestSink(t, Config{})
+	write(t, sink, "entry 1")
+	before, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = sink.Rotate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	write(t, sink, "entry 2")
+
+	// The rotated file keeps the identity of the original one, while a new file is created
+	names := backups(t, dir)
+	backup, err := os.Stat(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !os.SameFile(before, backup) || os.SameFile(before, after) {
+		t.Fatal("expected the file to be renamed and a new one to be created")
+	}
+}
+
+func Test_SinkBackups(t *testing.T) {
+	sink, dir := newTestSink(t, Config{MaxSize: 8, MaxBackups: 2, Compress: true})
+
+	for i := 1; i <= 5; i++ {
+		write(t, sink, fmt.Sprintf("entry %d", i))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := backups(t, dir)
+	if len(names) != 2 {
+		t.Fatalf("expected 2 backups, got %v", names)
+	}
+	for i, name := range names {
+		// The newest backup is compressed on the next rotation, as it may still be read
+		if compressed := strings.HasSuffix(name, ".log.gz"); compressed != (i < len(names)-1) {
+			t.Fatalf("expected only the older backups to be compressed, got %v", names)
+		}
+		if got, expected := readFile(t, filepath.Join(dir, name)), fmt.Sprintf("entry %d\n", i+3); got != expected {
+			t.Fatalf("expected backup contents %q, got %q", expected, got)
+		}
+	}
+}
+
+func Test_SinkReopen(t *testing.T) {
+	sink, dir := newTestSink(t, Config{ReopenOnSIGHUP: true})
+	write(t, sink, "entry 1")
+
+	// An external tool moves the file and signals the process
+	moved := filepath.Join(dir, "app.log.1")
+	if err := os.Rename(filepath.Join(dir, "app.log"), moved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sink.signals <- syscall.SIGHUP
+
+	deadline := time.Now().Add(time.Second)
+	for _, err := os.Stat(filepath.Join(dir, "app.log")); err != nil; _, err = os.Stat(filepath.Join(dir, "app.log")) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the file to be reopened")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	write(t, sink, "entry 2")
+
+	if got := readFile(t, moved); got != "entry 1\n" {
+		t.Fatalf("unexpected moved file contents %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.log")); got != "entry 2\n" {
+		t.Fatalf("unexpected file contents %q", got)
+	}
+}
+
+func Test_SinkConcurrentWriters(t *testing.T) {
+	sink, dir := newTestSink(t, Config{MaxSize: 256})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, _ = sink.Write([]byte(fmt.Sprintf("writer %d entry %02d\n", w, i)))
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Every entry is written whole to a single file
+	lines := 0
+	for _, name := range append(backups(t, dir), "app.log") {
+		for _, line := range strings.Split(strings.TrimSuffix(readFile(t, filepath.Join(dir, name)), "\n"), "\n") {
+			if !strings.HasPrefix(line, "writer ") || len(line) != len("writer 0 entry 00") {
+				t.Fatalf("unexpected line %q in %v", line, name)
+			}
+			lines++
+		}
+	}
+	if lines != 8*50 {
+		t.Fatalf("expected %d lines, got %d", 8*50, lines)
+	}
+
+	if _, err := sink.Write([]byte("entry\n")); err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+}
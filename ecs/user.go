@@ -0,0 +1,77 @@
+package ecs
+
+import (
+	"go.uber.org/zap"
+)
+
+const (
+	userTargetPrefix    = "user.target."
+	userEffectivePrefix = "user.effective."
+	userChangesPrefix   = "user.changes."
+)
+
+// UserInfo describes a user, to be emitted as any of the user.* nested field sets
+type UserInfo struct {
+	ID          string
+	Name        string
+	FullName    string
+	Email       string
+	Domain      string
+	Roles       []string
+	Hash        string
+	GroupID     string
+	GroupName   string
+	GroupDomain string
+}
+
+// User returns the user.* fields describing the acting user
+func User(u UserInfo) []zap.Field {
+	return u.fields(UserPrefix)
+}
+
+// UserTarget returns the user.target.* fields describing the user targeted by the event
+func UserTarget(u UserInfo) []zap.Field {
+	return u.fields(userTargetPrefix)
+}
+
+// UserEffective returns the user.effective.* fields describing the user the action
+// was performed as (for example, after privilege escalation)
+func UserEffective(u UserInfo) []zap.Field {
+	return u.fields(userEffectivePrefix)
+}
+
+// UserChanges returns the user.changes.* fields describing the updated user attributes
+func UserChanges(u UserInfo) []zap.Field {
+	return u.fields(userChangesPrefix)
+}
+
+// fields returns the non empty user attributes under the given prefix
+func (u UserInfo) fields(prefix string) []zap.Field {
+	fields := make([]zap.Field, 0, 10)
+	appendNonEmpty := func(key, val string) {
+		if val != "" {
+			fields = append(fields, zap.String(prefix+key, val))
+		}
+	}
+	appendNonEmpty("id", u.ID)
+	appendNonEmpty("name", u.Name)
+	appendNonEmpty("full_name", u.FullName)
+	appendNonEmpty("email", u.Email)
+	appendNonEmpty("domain", u.Domain)
+	if len(u.Roles) > 0 {
+		fields = append(fields, zap.Strings(prefix+"roles", u.Roles))
+	}
+	appendNonEmpty("hash", u.Hash)
+	appendNonEmpty("group.id", u.GroupID)
+	appendNonEmpty("group.name", u.GroupName)
+	appendNonEmpty("group.domain", u.GroupDomain)
+	return fields
+}
+
+// DefaultPIIFields are the personally identifiable user attributes
+var DefaultPIIFields = []string{
+	FieldUserFullName, FieldUserEmail,
+	FieldUserTargetFullName, FieldUserTargetEmail,
+	FieldUserEffectiveFullName, FieldUserEffectiveEmail,
+	FieldUserChangesFullName, FieldUserChangesEmail,
+}
@@ -3,7 +3,6 @@ module github.com/lggomez/zap-ecs
 go 1.14
 
 require (
-	github.com/json-iterator/go v1.1.11
 	github.com/pkg/errors v0.8.1
 	github.com/sebdah/goldie/v2 v2.5.3
 	go.uber.org/zap v1.17.0
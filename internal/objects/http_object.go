@@ -1,16 +1,12 @@
 package objects
 
 import (
-	stdJson "encoding/json"
-
-	jsoniter "github.com/json-iterator/go"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var json = jsoniter.ConfigFastest
-
-// HTTPObject is a specialized nested struct which transforms into a serialized field
+// HTTPObject is a specialized nested struct which maps its fields into the ECS http object
+// upon marshal
 type HTTPObject struct {
 	fields  []zap.Field
 	target  HTTPMarshalObject
@@ -19,48 +15,96 @@ type HTTPObject struct {
 }
 
 type HTTPMarshalObject struct {
-	Request  *HTTPRequestMarshalObject  `json:"request,omitempty"`
-	Response *HTTPResponseMarshalObject `json:"response,omitempty"`
+	Request  *HTTPRequestMarshalObject
+	Response *HTTPResponseMarshalObject
 }
 
 type HTTPRequestMarshalObject struct {
-	Body            *HTTPBodyMarshalObject `json:"body,omitempty"`
-	RequestMethod   string                 `json:"method,omitempty"`
-	RequestReferrer string                 `json:"referrer,omitempty"`
+	Body            *HTTPBodyMarshalObject
+	RequestMethod   string
+	RequestReferrer string
 }
 
 type HTTPResponseMarshalObject struct {
-	Body             *HTTPBodyMarshalObject `json:"body,omitempty"`
-	ResponseReferrer string                 `json:"referrer,omitempty"`
+	Body             *HTTPBodyMarshalObject
+	ResponseReferrer string
 }
 
 type HTTPBodyMarshalObject struct {
-	BodyContent string `json:"content,omitempty"`
-	Headers     string `json:"headers,omitempty"`
-	StatusCode  string `json:"status_code,omitempty"`
+	BodyContent string
+	Headers     string
+	StatusCode  string
 }
 
 func NestedObject(baseKey string, mapper func(zap.Field, *HTTPMarshalObject), fields ...zap.Field) *HTTPObject {
 	return &HTTPObject{baseKey: baseKey, fields: fields, mapper: mapper}
 }
 
+// NestedObjectOf returns the http object by value, so that it can be embedded and reused
+func NestedObjectOf(baseKey string, mapper func(zap.Field, *HTTPMarshalObject), fields ...zap.Field) HTTPObject {
+	return HTTPObject{baseKey: baseKey, fields: fields, mapper: mapper}
+}
+
+// MarshalLogObject marshals the object as required by the zap serializer
 func (f *HTTPObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
-	data, err := json.Marshal(&f.target)
-	enc.AddByteString(f.baseKey, data)
-	return err
+	f.target = HTTPMarshalObject{}
+	for _, field := range f.fields {
+		f.mapper(field, &f.target)
+	}
+	return f.target.MarshalLogObject(enc)
 }
 
+// AsField returns the object as a zap field. Marshal errors are reported by zap as a
+// "<baseKey>Error" field
 func (f *HTTPObject) AsField() zap.Field {
-	data, err := f.MarshalJSON()
-	if err != nil {
-		data = []byte(err.Error()) // TODO: should we propagate or log separately?
+	return zap.Object(f.baseKey, f)
+}
+
+func (o *HTTPMarshalObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if o.Request != nil {
+		if err := enc.AddObject("request", o.Request); err != nil {
+			return err
+		}
+	}
+	if o.Response != nil {
+		if err := enc.AddObject("response", o.Response); err != nil {
+			return err
+		}
 	}
-	return zap.Any(f.baseKey, stdJson.RawMessage(data))
+	return nil
 }
 
-func (f *HTTPObject) MarshalJSON() ([]byte, error) {
-	for _, field := range f.fields {
-		f.mapper(field, &f.target)
+func (o *HTTPRequestMarshalObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if o.Body != nil {
+		if err := enc.AddObject("body", o.Body); err != nil {
+			return err
+		}
+	}
+	addNonEmptyString(enc, "method", o.RequestMethod)
+	addNonEmptyString(enc, "referrer", o.RequestReferrer)
+	return nil
+}
+
+func (o *HTTPResponseMarshalObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if o.Body != nil {
+		if err := enc.AddObject("body", o.Body); err != nil {
+			return err
+		}
+	}
+	addNonEmptyString(enc, "referrer", o.ResponseReferrer)
+	return nil
+}
+
+func (o *HTTPBodyMarshalObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	addNonEmptyString(enc, "content", o.BodyContent)
+	addNonEmptyString(enc, "headers", o.Headers)
+	addNonEmptyString(enc, "status_code", o.StatusCode)
+	return nil
+}
+
+// addNonEmptyString adds the string value unless it is empty
+func addNonEmptyString(enc zapcore.ObjectEncoder, key, value string) {
+	if value != "" {
+		enc.AddString(key, value)
 	}
-	return json.Marshal(&f.target)
 }
@@ -14,6 +14,20 @@ func AsObject(fields ...zap.Field) *Object {
 	return &Object{fields}
 }
 
+// ObjectOf returns the object by value, so that it can be embedded and reused
+func ObjectOf(fields ...zap.Field) Object {
+	return Object{fields}
+}
+
+// EmptyObject encodes an empty object without allocating
+var EmptyObject zapcore.ObjectMarshaler = emptyObject{}
+
+type emptyObject struct{}
+
+func (emptyObject) MarshalLogObject(zapcore.ObjectEncoder) error {
+	return nil
+}
+
 // MarshalLogObject marshals the object as required by the zap serializer
 func (f *Object) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	for _, field := range f.fields {
@@ -0,0 +1,89 @@
+package objects
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// PathObject is a field wrapper which encodes dotted path keys into nested objects upon marshal,
+// so that a "thread.id" key is represented as {"thread": {"id": ...}}
+type PathObject struct {
+	fields []zap.Field
+}
+
+func AsPathObject(fields ...zap.Field) *PathObject {
+	return &PathObject{fields}
+}
+
+// PathObjectOf returns the path object by value, so that it can be embedded and reused
+func PathObjectOf(fields ...zap.Field) PathObject {
+	return PathObject{fields}
+}
+
+// PathLeafKey is the key of a leaf value within the object of the fields nested under its key,
+// so that "request" and "request.id" are represented as {"request": {"_value": ..., "id": ...}}
+// instead of repeating the request key
+const PathLeafKey = "_value"
+
+// MarshalLogObject marshals the object as required by the zap serializer
+func (f *PathObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for i, field := range f.fields {
+		head, _, nested := splitPath(field.Key)
+		if !nested {
+			if !isPathEmitted(f.fields, head) {
+				field.AddTo(enc)
+			}
+			// Otherwise, the leaf is added to the object of the fields nested under its key
+			continue
+		}
+
+		if isPathEmitted(f.fields[:i], head) {
+			// Children of this path were already grouped by the first field that contained it
+			continue
+		}
+
+		children := make([]zap.Field, 0, len(f.fields)-i)
+		var leaves []zap.Field
+		hasLeafKey := false
+		for _, child := range f.fields {
+			childHead, tail, ok := splitPath(child.Key)
+			switch {
+			case ok && childHead == head:
+				hasLeafKey = hasLeafKey || tail == PathLeafKey
+				child.Key = tail
+				children = append(children, child)
+			case !ok && child.Key == head:
+				child.Key = PathLeafKey
+				leaves = append(leaves, child)
+			}
+		}
+		if !hasLeafKey {
+			// Leaves are dropped if the reserved key is taken by a nested field
+			children = append(leaves, children...)
+		}
+		if err := enc.AddObject(head, AsPathObject(children...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPath splits a dotted key into its first token and the remaining path
+func splitPath(key string) (head, tail string, nested bool) {
+	idx := strings.IndexByte(key, '.')
+	if idx < 0 {
+		return key, "", false
+	}
+	return key[:idx], key[idx+1:], true
+}
+
+func isPathEmitted(fields []zap.Field, head string) bool {
+	for _, field := range fields {
+		if fieldHead, _, nested := splitPath(field.Key); nested && fieldHead == head {
+			return true
+		}
+	}
+	return false
+}
@@ -30,6 +30,15 @@ func AssertBytesAsJSON(t *testing.T, testCase string, bytes []byte) {
 	g.AssertJson(t, caseName, object)
 }
 
+// AssertBytes asserts the bytes against the golden file as they are, for encoders whose
+// output must be byte-for-byte stable
+func AssertBytes(t *testing.T, testCase string, bytes []byte) {
+	t.Helper()
+
+	caseName := createCanonicalTestCaseName(t, testCase)
+	goldie.New(t).Assert(t, caseName, bytes)
+}
+
 // createCanonicalTestCaseName Generate a canonical name for this test case
 // and validates that it is not already in use
 func createCanonicalTestCaseName(t *testing.T, testCase string) string {
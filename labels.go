@@ -0,0 +1,114 @@
+package zapecs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LabelsPolicy determines how the custom (non ECS) fields are added to the labels object
+type LabelsPolicy int
+
+const (
+	// LabelsAny adds the custom fields to labels as they are, regardless of their type
+	LabelsAny LabelsPolicy = iota
+	// LabelsKeyword follows the ECS labels definition: scalar custom fields are added to labels
+	// as keyword (string) values, while the rest are routed to the custom namespace, or dropped
+	// if there is none
+	LabelsKeyword
+)
+
+// labelsConfig holds the labels policy settings shared by the logger entries
+type labelsConfig struct {
+	policy    LabelsPolicy
+	namespace string
+	dropped   *uint64
+}
+
+func newLabelsConfig(policy LabelsPolicy, namespace string) labelsConfig {
+	return labelsConfig{
+		policy:    policy,
+		namespace: namespace,
+		dropped:   new(uint64),
+	}
+}
+
+// countDropped increments the dropped labels counter
+func (c labelsConfig) countDropped() {
+	if c.dropped != nil {
+		atomic.AddUint64(c.dropped, 1)
+	}
+}
+
+func (l zapECSLogger) DroppedLabels() uint64 {
+	if l.labels.dropped == nil {
+		return 0
+	}
+	return atomic.LoadUint64(l.labels.dropped)
+}
+
+// keywordLabel returns the field as a keyword (string) field if it holds a scalar value
+func keywordLabel(f zap.Field) (zap.Field, bool) {
+	var val string
+	switch f.Type {
+	case zapcore.StringType:
+		return f, true
+	case zapcore.BoolType:
+		val = strconv.FormatBool(f.Integer == 1)
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		val = strconv.FormatInt(f.Integer, 10)
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type, zapcore.UintptrType:
+		val = strconv.FormatUint(uint64(f.Integer), 10)
+	case zapcore.Float64Type:
+		val = strconv.FormatFloat(math.Float64frombits(uint64(f.Integer)), 'f', -1, 64)
+	case zapcore.Float32Type:
+		val = strconv.FormatFloat(float64(math.Float32frombits(uint32(f.Integer))), 'f', -1, 32)
+	case zapcore.DurationType:
+		val = time.Duration(f.Integer).String()
+	case zapcore.TimeType:
+		t := time.Unix(0, f.Integer)
+		if loc, ok := f.Interface.(*time.Location); ok {
+			t = t.In(loc)
+		}
+		val = t.Format(time.RFC3339Nano)
+	case zapcore.TimeFullType:
+		val = f.Interface.(time.Time).Format(time.RFC3339Nano)
+	case zapcore.BinaryType:
+		val = base64.StdEncoding.EncodeToString(f.Interface.([]byte))
+	case zapcore.ByteStringType:
+		val = string(f.Interface.([]byte))
+	case zapcore.Complex128Type, zapcore.Complex64Type, zapcore.StringerType, zapcore.ErrorType:
+		val = fmt.Sprint(f.Interface)
+	case zapcore.ReflectType:
+		if !isScalarValue(f.Interface) {
+			return f, false
+		}
+		val = fmt.Sprint(f.Interface)
+	default:
+		return f, false
+	}
+	return zap.String(f.Key, val), true
+}
+
+// isScalarValue reports whether the value is a boolean, a number or a string
+func isScalarValue(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	default:
+		return false
+	}
+}
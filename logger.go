@@ -1,7 +1,9 @@
 package zapecs
 
 import (
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/lggomez/zap-ecs/ecs"
 	"github.com/lggomez/zap-ecs/internal/objects"
@@ -13,41 +15,178 @@ import (
 type Logger interface {
 	SetLevel(level Level)
 
+	// With returns a child logger adding the given fields to all its entries
+	With(fields ...zap.Field) Logger
+	// WithTags returns a child logger adding the given tags to all its entries
+	WithTags(tags ...string) Logger
+
 	Debug(msg string, fields ...zap.Field)
 	Info(msg string, fields ...zap.Field)
 	Warn(msg string, fields ...zap.Field)
 	Error(msg string, fields ...zap.Field)
+	DPanic(msg string, fields ...zap.Field)
 	Panic(msg string, fields ...zap.Field)
 	Fatal(msg string, fields ...zap.Field)
 
 	Flush() error
+	// Close flushes the logger and stops the periodic sampling summaries, shared with its parent
+	// and children. Summaries of the entries logged afterwards are written along with them
+	Close() error
+}
+
+// LoggerStats exposes the counters of the ecs logger. The loggers returned by NewECSLogger and
+// their children implement it
+type LoggerStats interface {
+	// DroppedLabels returns the number of custom fields dropped by the LabelsKeyword policy
+	DroppedLabels() uint64
+	// DuplicateFields returns the number of fields discarded by the DuplicateCount policy
+	DuplicateFields() uint64
 }
 
 type zapECSLogger struct {
 	baseLoggerField zap.Field
 	baseTags        []string
+	sortTags        bool
 	baseLabels      []zap.Field
+	labelProviders  []LabelProvider
 	logger          *zap.Logger
+	piiPolicy       PIIPolicy
+	piiFields       map[string]struct{}
+	piiHashKey      []byte
+	eventValidation EventValidation
+	originLevel     zapcore.LevelEnabler
+	callerSkip      int
+	originFrame     *runtime.Frame
+	labels          labelsConfig
+	namespaces      customNamespaces
+	contextFields   []sourcedField
+	duplicatePolicy DuplicatePolicy
+	duplicates      *uint64
+	sampler         *sampler
+	dataStream      []zap.Field
+
+	stacktraceLevel   zapcore.LevelEnabler
+	stacktraceFormat  StacktraceFormat
+	stacktraceMaxSize int
+
+	development bool
+	onFatal     FatalHook
 }
 
 type Options struct {
 	BaseLoggerField zap.Field
 	BaseTags        []string
-	BaseLabels      []zap.Field
-	Logger          *zap.Logger
+	// SortTags sorts the merged base and entry tags, which are otherwise kept in order of occurrence
+	SortTags   bool
+	BaseLabels []zap.Field
+	// LabelProviders provide base labels evaluated on each entry, after the static BaseLabels
+	LabelProviders []LabelProvider
+	Logger         *zap.Logger
+	// Outputs are teed with the Logger core, if any, each with its own encoder, levels and filter
+	Outputs []Output
+	// PIIPolicy determines how PII fields are logged. Defaults to PIIKeep
+	PIIPolicy PIIPolicy
+	// PIIFields are the keys of the fields subject to PIIPolicy. Nil means ecs.DefaultPIIFields
+	PIIFields []string
+	// PIIHashKey is the secret key of the PIIHash policy HMAC. Without it the values are hashed
+	// with plain SHA-256, which does not prevent guessing them
+	PIIHashKey []byte
+	// EventValidation determines how event fields with values not allowed by ECS are logged.
+	// Defaults to EventValidationNone
+	EventValidation EventValidation
+	// OriginLevel enables the log.origin.* caller fields for the levels it enables. Nil disables them
+	OriginLevel zapcore.LevelEnabler
+	// CallerSkip is the number of additional frames to skip when resolving the log origin, for
+	// consumers that wrap the logger
+	CallerSkip int
+	// LabelsPolicy determines how custom fields are added to the labels object. Defaults to LabelsAny
+	LabelsPolicy LabelsPolicy
+	// CustomNamespace is the top level object receiving the non scalar custom fields under the
+	// LabelsKeyword policy, as recommended by ECS for custom fields. Empty means they are dropped
+	CustomNamespace string
+	// CustomNamespaces maps custom field key prefixes to the top level objects receiving them,
+	// keeping the rest of their dotted path (for example, "order.*" to "order"). Routes to
+	// objects named as ECS field sets or root keys, such as event or labels, are ignored
+	CustomNamespaces map[string]string
+	// DefaultNamespace is the top level object receiving the custom fields not matched by
+	// CustomNamespaces, keeping their full dotted path. Empty, or an ECS field set or root key
+	// name, means they are added to labels
+	DefaultNamespace string
+	// DuplicatePolicy determines how fields sharing the same key across base labels, With context
+	// and entry fields are resolved. Defaults to DuplicateFirstWins
+	DuplicatePolicy DuplicatePolicy
+	// DataStreamType, DataStreamDataset and DataStreamNamespace are the data_stream.* fields of
+	// the entries lacking them, sanitized. If any is set, the rest default to logs, generic and
+	// default, and event.dataset is kept in sync with data_stream.dataset
+	DataStreamType      ecs.DataStreamTypeValue
+	DataStreamDataset   string
+	DataStreamNamespace string
+	// Sampling configures the sampling and rate limiting of the entries. Nil disables them
+	Sampling *SamplingOptions
+	// StacktraceLevel enables the error.stack_trace capture for the levels it enables. Nil disables it
+	StacktraceLevel zapcore.LevelEnabler
+	// StacktraceFormat determines the captured stack trace representation. Defaults to StacktraceCompact
+	StacktraceFormat StacktraceFormat
+	// StacktraceMaxSize caps the captured stack trace size in bytes. Zero means 32KiB
+	StacktraceMaxSize int
+	// Development makes DPanic entries panic after being written
+	Development bool
+	// OnFatal is run after Fatal entries are written and the logger is flushed. Nil means FatalExit(1)
+	OnFatal FatalHook
 }
 
 func NewECSLogger(o Options) Logger {
-	return &zapECSLogger{
+	logger := o.Logger
+	if len(o.Outputs) > 0 {
+		logger = withOutputs(logger, o.Outputs)
+	}
+	if logger != nil {
+		// Skip the ECS logger frame so that zap caller annotations point to the consumer
+		logger = logger.WithOptions(zap.AddCallerSkip(1 + o.CallerSkip))
+		if o.Development {
+			logger = logger.WithOptions(zap.Development())
+		}
+	}
+
+	l := &zapECSLogger{
 		baseLoggerField: o.BaseLoggerField,
 		baseTags:        o.BaseTags,
+		sortTags:        o.SortTags,
 		baseLabels:      o.BaseLabels,
-		logger:          o.Logger,
+		labelProviders:  o.LabelProviders,
+		logger:          logger,
+		piiPolicy:       o.PIIPolicy,
+		piiFields:       newPIIFieldSet(o.PIIFields),
+		piiHashKey:      o.PIIHashKey,
+		eventValidation: o.EventValidation,
+		originLevel:     o.OriginLevel,
+		callerSkip:      o.CallerSkip,
+		labels:          newLabelsConfig(o.LabelsPolicy, o.CustomNamespace),
+		namespaces:      newCustomNamespaces(o.CustomNamespaces, o.DefaultNamespace),
+		duplicatePolicy: o.DuplicatePolicy,
+		duplicates:      new(uint64),
+		sampler:         newSampler(o.Sampling),
+		dataStream:      newDataStreamDefaults(o.DataStreamType, o.DataStreamDataset, o.DataStreamNamespace),
+
+		stacktraceLevel:   o.StacktraceLevel,
+		stacktraceFormat:  o.StacktraceFormat,
+		stacktraceMaxSize: o.StacktraceMaxSize,
+
+		development: o.Development,
+		onFatal:     o.OnFatal,
 	}
+	if l.sampler != nil && logger != nil {
+		l.sampler.startSummaries(l.writeDueSummary)
+	}
+	return l
 }
 
+// fieldAccumulators hold the per entry encoding state. They are pooled, so the encoded
+// fields must not be retained once the entry is written
 type fieldAccumulators struct {
-	l Level
+	l          Level
+	labels     labelsConfig
+	namespaces customNamespaces
 
 	labelsFieldsAccum []zap.Field
 	logFieldsAccum    []zap.Field
@@ -55,148 +194,471 @@ type fieldAccumulators struct {
 	eventFieldsAccum  []zap.Field
 	errorFieldsAccum  []zap.Field
 	traceFieldsAccum  []zap.Field
+	customFieldsAccum []customObject
+
+	// Nested namespace fields, indexed as nestedNamespaces
+	nestedFieldsAccum [][]zap.Field
+
+	// Entry fields before and after the duplicate resolution, along with the index of the
+	// occurrence kept for each path
+	stream   []sourcedField
+	resolved []sourcedField
+	kept     map[fieldPath]int
+
+	tags tagArray
+	out  []zap.Field
+
+	// Object marshalers of the encoded fields, embedded to avoid allocating them per entry
+	logObject     objects.PathObject
+	eventObject   objects.PathObject
+	errorObject   objects.Object
+	traceObject   objects.Object
+	labelsObject  objects.Object
+	httpObject    objects.HTTPObject
+	nestedObjects []objects.PathObject
+}
+
+// nestedNamespace describes an ECS field set that is emitted as a nested object
+type nestedNamespace struct {
+	prefix  string
+	baseKey string
+}
+
+// nestedNamespaces are the ECS field sets whose fields keep their full dotted path inside
+// their base object. Unlike the core objects, these are omitted from the entry when empty
+var nestedNamespaces = []nestedNamespace{
+	{prefix: ecs.ProcessPrefix, baseKey: ecs.ProcessBaseLevelKey},
+	{prefix: ecs.ContainerPrefix, baseKey: ecs.ContainerBaseLevelKey},
+	{prefix: ecs.OrchestratorPrefix, baseKey: ecs.OrchestratorBaseLevelKey},
+	{prefix: ecs.KubernetesPrefix, baseKey: ecs.KubernetesBaseLevelKey},
+	{prefix: ecs.CloudPrefix, baseKey: ecs.CloudBaseLevelKey},
+	{prefix: ecs.UserPrefix, baseKey: ecs.UserBaseLevelKey},
+	{prefix: ecs.GroupPrefix, baseKey: ecs.GroupBaseLevelKey},
+	{prefix: ecs.OrganizationPrefix, baseKey: ecs.OrganizationBaseLevelKey},
+	{prefix: ecs.DataStreamPrefix, baseKey: ecs.DataStreamBaseLevelKey},
+}
+
+// maxPooledFields caps the size of the accumulators returned to the pool, so that
+// occasional large entries do not retain their memory
+const maxPooledFields = 1024
+
+var fieldAccumulatorsPool = sync.Pool{
+	New: func() interface{} {
+		return newFieldAccumulators()
+	},
 }
 
-func newFieldAccumulators(labelsSize int, l Level) *fieldAccumulators {
-	a := &fieldAccumulators{l: l}
-	// Labels final size is non-deterministic, so we allocate it with an extra threshold
-	a.labelsFieldsAccum = make([]zap.Field, 0, labelsSize+labelsSize/2)
+func newFieldAccumulators() *fieldAccumulators {
+	a := &fieldAccumulators{}
+	a.labelsFieldsAccum = make([]zap.Field, 0, 16)
 	a.logFieldsAccum = make([]zap.Field, 0, 2)
 	a.httpFieldsAccum = make([]zap.Field, 0, 7)
 	a.eventFieldsAccum = make([]zap.Field, 0, 7)
 	a.errorFieldsAccum = make([]zap.Field, 0, 7)
 	a.traceFieldsAccum = make([]zap.Field, 0, 1)
+	a.nestedFieldsAccum = make([][]zap.Field, len(nestedNamespaces))
+	a.nestedObjects = make([]objects.PathObject, len(nestedNamespaces))
+	a.stream = make([]sourcedField, 0, 16)
+	a.resolved = make([]sourcedField, 0, 16)
+	a.kept = make(map[fieldPath]int, 16)
+	a.out = make([]zap.Field, 0, 16)
 	return a
 }
 
+// getFieldAccumulators returns pooled accumulators for an entry of the given level
+func getFieldAccumulators(l Level, labels labelsConfig, namespaces customNamespaces) *fieldAccumulators {
+	a := fieldAccumulatorsPool.Get().(*fieldAccumulators)
+	a.l = l
+	a.labels = labels
+	a.namespaces = namespaces
+	return a
+}
+
+// release resets the accumulators and returns them to the pool
+func (a *fieldAccumulators) release() {
+	if cap(a.stream) > maxPooledFields || cap(a.out) > maxPooledFields {
+		return
+	}
+
+	a.labelsFieldsAccum = resetFields(a.labelsFieldsAccum)
+	a.logFieldsAccum = resetFields(a.logFieldsAccum)
+	a.httpFieldsAccum = resetFields(a.httpFieldsAccum)
+	a.eventFieldsAccum = resetFields(a.eventFieldsAccum)
+	a.errorFieldsAccum = resetFields(a.errorFieldsAccum)
+	a.traceFieldsAccum = resetFields(a.traceFieldsAccum)
+	for i := range a.nestedFieldsAccum {
+		a.nestedFieldsAccum[i] = resetFields(a.nestedFieldsAccum[i])
+		a.nestedObjects[i] = objects.PathObject{}
+	}
+	for i := range a.customFieldsAccum {
+		a.customFieldsAccum[i].fields = resetFields(a.customFieldsAccum[i].fields)
+		a.customFieldsAccum[i].object = objects.PathObject{}
+	}
+	a.customFieldsAccum = a.customFieldsAccum[:0]
+	for i := range a.stream {
+		a.stream[i] = sourcedField{}
+	}
+	a.stream = a.stream[:0]
+	for i := range a.resolved {
+		a.resolved[i] = sourcedField{}
+	}
+	a.resolved = a.resolved[:0]
+	for path := range a.kept {
+		delete(a.kept, path)
+	}
+	a.tags = a.tags[:0]
+	a.out = resetFields(a.out)
+	a.logObject, a.eventObject = objects.PathObject{}, objects.PathObject{}
+	a.errorObject, a.traceObject, a.labelsObject = objects.Object{}, objects.Object{}, objects.Object{}
+	a.httpObject = objects.HTTPObject{}
+	a.labels, a.namespaces = labelsConfig{}, customNamespaces{}
+
+	fieldAccumulatorsPool.Put(a)
+}
+
+// resetFields clears the fields, so that the pooled slice does not retain their values
+func resetFields(fields []zap.Field) []zap.Field {
+	for i := range fields {
+		fields[i] = zap.Field{}
+	}
+	return fields[:0]
+}
+
 // reduceKey gets the last element from a dotted path object key
 func reduceKey(field zap.Field) zap.Field {
-	keyTokens := strings.Split(field.Key, ".")
-	field.Key = keyTokens[len(keyTokens)-1]
+	if idx := strings.LastIndexByte(field.Key, '.'); idx >= 0 {
+		field.Key = field.Key[idx+1:]
+	}
 	return field
 }
 
+// appendNestedField adds the field to its nested namespace object, if any. The namespace
+// prefix is trimmed from the key while the rest of the dotted path is kept
+func (a *fieldAccumulators) appendNestedField(f zap.Field) bool {
+	for i, ns := range nestedNamespaces {
+		if strings.HasPrefix(f.Key, ns.prefix) {
+			f.Key = f.Key[len(ns.prefix):]
+			a.nestedFieldsAccum[i] = append(a.nestedFieldsAccum[i], f)
+			return true
+		}
+	}
+	return false
+}
+
+// objectPrefixes are the prefixes of the ECS core objects
+var objectPrefixes = []string{ecs.LogPrefix, ecs.HTTPPrefix, ecs.EventPrefix, ecs.ErrorPrefix, ecs.TracePrefix}
+
+// isNestedKey reports whether the key belongs to a nested namespace
+func isNestedKey(key string) bool {
+	for _, ns := range nestedNamespaces {
+		if strings.HasPrefix(key, ns.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *fieldAccumulators) appendField(f zap.Field) {
-	if strings.HasPrefix(f.Key, ecs.LogPrefix) {
+	if a.appendNestedField(f) {
+		// Field is part of a nested namespace object
+		return
+	} else if strings.HasPrefix(f.Key, ecs.LogPrefix) {
 		// Field is part of the log object
-		a.logFieldsAccum = append(a.logFieldsAccum, reduceKey(f))
+		f.Key = f.Key[len(ecs.LogPrefix):]
+		a.logFieldsAccum = append(a.logFieldsAccum, f)
 	} else if strings.HasPrefix(f.Key, ecs.HTTPPrefix) {
 		// Field is part of the http object
 		// Don't sanitize key
 		a.httpFieldsAccum = append(a.httpFieldsAccum, f)
 	} else if strings.HasPrefix(f.Key, ecs.EventPrefix) {
 		// Field is part of the event object
-		a.eventFieldsAccum = append(a.eventFieldsAccum, reduceKey(f))
+		f.Key = f.Key[len(ecs.EventPrefix):]
+		a.eventFieldsAccum = append(a.eventFieldsAccum, f)
 	} else if strings.HasPrefix(f.Key, ecs.ErrorPrefix) {
 		// Field is part of the error object
 		a.errorFieldsAccum = append(a.errorFieldsAccum, reduceKey(f))
 	} else if strings.HasPrefix(f.Key, ecs.TracePrefix) {
 		// Field is part of the error object
 		a.traceFieldsAccum = append(a.traceFieldsAccum, reduceKey(f))
+	} else if object, key, ok := a.namespaces.route(f.Key); ok {
+		// Field is part of a custom namespace object
+		f.Key = key
+		a.appendCustomField(object, f)
 	} else {
 		// No match: field is part of the labels object
-		a.labelsFieldsAccum = append(a.labelsFieldsAccum, reduceKey(f))
+		a.appendLabelField(f)
 	}
 }
 
-func (a *fieldAccumulators) emitLogFields(baseLoggerField zap.Field) []zap.Field {
-	ret := make([]zap.Field, 0, 8)
+// appendLabelField adds the custom field to the labels object according to the labels policy
+func (a *fieldAccumulators) appendLabelField(f zap.Field) {
+	if a.labels.policy != LabelsKeyword {
+		a.labelsFieldsAccum = append(a.labelsFieldsAccum, reduceKey(f))
+		return
+	}
+
+	if label, ok := keywordLabel(f); ok {
+		a.labelsFieldsAccum = append(a.labelsFieldsAccum, reduceKey(label))
+	} else if a.labels.namespace != "" {
+		a.appendCustomField(a.labels.namespace, f)
+	} else {
+		a.labels.countDropped()
+	}
+}
 
+// emitLogFields appends the ECS objects to the output fields
+func (a *fieldAccumulators) emitLogFields(baseLoggerField zap.Field) {
 	// Add logger fields
-	a.logFieldsAccum = append(a.logFieldsAccum,
-		reduceKey(baseLoggerField),
-		reduceKey(zap.String(ecs.FieldLogLevel, a.l.String())))
+	if baseLoggerField.Key != "" {
+		a.appendField(baseLoggerField)
+	}
+	a.appendField(zap.String(ecs.FieldLogLevel, a.l.String()))
+
+	a.logObject = objects.PathObjectOf(a.logFieldsAccum...)
+	a.eventObject = objects.PathObjectOf(a.eventFieldsAccum...)
+	a.errorObject = objects.ObjectOf(a.errorFieldsAccum...)
+	a.traceObject = objects.ObjectOf(a.traceFieldsAccum...)
+	a.labelsObject = objects.ObjectOf(a.labelsFieldsAccum...)
+
+	httpField := zap.Object(ecs.HTTPBaseLevelKey, objects.EmptyObject)
+	if len(a.httpFieldsAccum) > 0 {
+		a.httpObject = objects.NestedObjectOf(ecs.HTTPBaseLevelKey, objects.HTTPECSMapper, a.httpFieldsAccum...)
+		httpField = a.httpObject.AsField()
+	}
 
 	// Encode labels log object and add field
-	ret = append(ret,
-		zap.Object(ecs.LogBaseLevelKey, objects.AsObject(a.logFieldsAccum...)),
-		objects.NestedObject(ecs.HTTPBaseLevelKey, objects.HTTPECSMapper, a.httpFieldsAccum...).AsField(),
-		zap.Object(ecs.EventBaseLevelKey, objects.AsObject(a.eventFieldsAccum...)),
-		zap.Object(ecs.ErrorBaseLevelKey, objects.AsObject(a.errorFieldsAccum...)),
-		zap.Object(ecs.TraceBaseLevelKey, objects.AsObject(a.traceFieldsAccum...)),
-		zap.Object(ecs.FieldLabels, objects.AsObject(a.labelsFieldsAccum...)))
+	a.out = append(a.out,
+		zap.Object(ecs.LogBaseLevelKey, &a.logObject),
+		httpField,
+		zap.Object(ecs.EventBaseLevelKey, &a.eventObject),
+		zap.Object(ecs.ErrorBaseLevelKey, &a.errorObject),
+		zap.Object(ecs.TraceBaseLevelKey, &a.traceObject),
+		zap.Object(ecs.FieldLabels, &a.labelsObject))
+
+	// Encode non empty nested namespace objects
+	for i, ns := range nestedNamespaces {
+		if len(a.nestedFieldsAccum[i]) > 0 {
+			a.nestedObjects[i] = objects.PathObjectOf(a.nestedFieldsAccum[i]...)
+			a.out = append(a.out, zap.Object(ns.baseKey, &a.nestedObjects[i]))
+		}
+	}
 
-	return ret
+	// Encode custom namespace objects
+	for i := range a.customFieldsAccum {
+		object := &a.customFieldsAccum[i]
+		object.object = objects.PathObjectOf(object.fields...)
+		a.out = append(a.out, zap.Object(object.name, &object.object))
+	}
 }
 
-func (l zapECSLogger) encodeFields(fields []zap.Field, lvl Level) []zap.Field {
-	// Do no process entries more than once per key (ignore duplicates)
-	processedFields := make(map[string]struct{}, len(fields))
+// encodeFields encodes the entry fields into pooled accumulators, whose out fields must be
+// written before releasing them. skip is the number of frames between the caller and the
+// logger consumer, used to resolve the log origin
+func (l zapECSLogger) encodeFields(fields []zap.Field, lvl Level, skip int) *fieldAccumulators {
+	accums := getFieldAccumulators(lvl, l.labels, l.namespaces)
 
-	// Prepare field slices
-	logFields := make([]zap.Field, 0, len(fields)+len(l.baseLabels))
-	accums := newFieldAccumulators(len(l.baseLabels), lvl)
-	entryTags := make([]string, 0, len(l.baseTags))
-	entryTags = append(entryTags, l.baseTags...)
+	// Resolve duplicated keys across base labels, context and entry fields
+	resolvedFields := l.resolveFields(accums, fields)
+	accums.tags = append(accums.tags, l.baseTags...)
+	dataset, dataStreamEnabled := l.entryDataset(resolvedFields)
 
 	// Filter fields into ECS and label fields, merging tags in the process
-	for _, field := range fields {
-		if _, found := processedFields[field.Key]; found {
-			// discard duplicate fields by key
+	for _, sf := range resolvedFields {
+		if dataStreamEnabled && isDatasetKey(sf.Key) {
+			// The dataset is written by the data stream fields below
+			continue
+		}
+		field := sf.Field
+		var keep bool
+		if field, keep = l.applyPIIPolicy(field); !keep || !l.validateEventField(field, skip+1) {
 			continue
 		}
+		field = sanitizeDataStreamField(field)
 
-		processedFields[field.Key] = struct{}{}
-		// Check if the field is an ECS standard field or not, and process accordingly
-		if ecs.IsECSFieldName(field.Key) {
-			switch field.Key {
-			case ecs.FieldTags:
-				// In the case of tags, we'll be merging the field tags add create the field later
-				if field.Interface != nil {
-					tags := field.Interface.([]string)
-					entryTags = append(entryTags, tags...)
-				}
-			default:
-				accums.appendField(field)
+		switch {
+		case field.Key == ecs.FieldTags:
+			// In the case of tags, we'll be merging the field tags add create the field later
+			if tags, ok := tagValues(field); ok {
+				accums.tags = append(accums.tags, tags...)
 			}
-		} else {
+		case sf.root:
+			// Base labels not belonging to any object are added at the root level
+			accums.out = append(accums.out, field)
+		default:
+			accums.appendField(field)
+		}
+	}
+
+	// Add the data stream fields missing from the entry, along with the synced dataset
+	if dataStreamEnabled {
+		for _, field := range l.dataStreamFields(resolvedFields, dataset) {
+			accums.appendField(field)
+		}
+	}
+
+	// Add the log origin, unless the entry already has it
+	for _, field := range l.originFields(lvl, skip+1) {
+		if !hasFieldKey(resolvedFields, field.Key) {
+			accums.appendField(field)
+		}
+	}
+
+	// Add the stack trace, unless the entry already has it
+	if !hasFieldKey(resolvedFields, ecs.FieldStackTrace) {
+		if field, ok := l.stacktraceField(lvl); ok {
 			accums.appendField(field)
 		}
 	}
 
 	// Add tags field
-	if len(entryTags) > 0 {
-		logFields = append(logFields, zap.Strings(ecs.FieldTags, entryTags))
+	if accums.tags = normalizeTags(accums.tags, l.sortTags); len(accums.tags) > 0 {
+		accums.out = append(accums.out, zap.Array(ecs.FieldTags, &accums.tags))
 	}
 
 	// Add the rest of the fields
-	logFields = append(logFields, l.baseLabels...)
-	logFields = append(logFields, accums.emitLogFields(l.baseLoggerField)...)
+	accums.emitLogFields(l.baseLoggerField)
 
-	return logFields
+	return accums
+}
+
+// rootKeys are the root level keys written by the logger and the ECS encoders
+var rootKeys = map[string]struct{}{
+	ecs.FieldTimestamp: {}, ecs.FieldMessage: {}, ecs.FieldECSVersion: {}, ecs.FieldLogLevel: {}, ecs.FieldLogger: {},
+	ecs.FieldTags: {}, ecs.FieldLabels: {}, ecs.LogBaseLevelKey: {}, ecs.HTTPBaseLevelKey: {}, ecs.EventBaseLevelKey: {},
+	ecs.ErrorBaseLevelKey: {}, ecs.TraceBaseLevelKey: {},
+}
+
+// isRootField reports whether the field is a base label added at the root level, as it does
+// not belong to any object nor collides with one. Colliding base labels are added to labels
+func (l zapECSLogger) isRootField(sf sourcedField) bool {
+	if !sf.base || l.isObjectKey(sf.Key) {
+		return false
+	}
+	if _, found := rootKeys[sf.Key]; found {
+		return false
+	}
+	for _, ns := range nestedNamespaces {
+		if sf.Key == ns.baseKey {
+			return false
+		}
+	}
+	return !l.namespaces.isObject(sf.Key) && sf.Key != l.namespaces.defaultObject && sf.Key != l.labels.namespace
+}
+
+// isObjectKey reports whether the key belongs to an ECS object or a custom namespace route
+func (l zapECSLogger) isObjectKey(key string) bool {
+	if isNestedKey(key) {
+		return true
+	}
+	if _, _, ok := l.namespaces.matchRoute(key); ok {
+		return true
+	}
+	for _, prefix := range objectPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l zapECSLogger) With(fields ...zap.Field) Logger {
+	child := l
+	child.contextFields = make([]sourcedField, 0, len(l.contextFields)+len(fields))
+	child.contextFields = append(child.contextFields, l.contextFields...)
+	for _, field := range fields {
+		child.contextFields = append(child.contextFields, sourcedField{Field: field})
+	}
+	return &child
+}
+
+func (l zapECSLogger) WithTags(tags ...string) Logger {
+	child := l
+	child.baseTags = make([]string, 0, len(l.baseTags)+len(tags))
+	child.baseTags = append(child.baseTags, l.baseTags...)
+	child.baseTags = append(child.baseTags, tags...)
+	return &child
 }
 
 func (l zapECSLogger) Debug(msg string, fields ...zap.Field) {
-	filteredFields := l.encodeFields(fields, DebugLevel)
-	l.logger.Debug(msg, filteredFields...)
+	if !l.logger.Core().Enabled(DebugLevel) || !l.sample(DebugLevel, msg, fields) {
+		return
+	}
+	accums := l.encodeFields(fields, DebugLevel, 1)
+	l.logger.Debug(msg, accums.out...)
+	accums.release()
 }
 
 func (l zapECSLogger) Info(msg string, fields ...zap.Field) {
-	filteredFields := l.encodeFields(fields, InfoLevel)
-	l.logger.Info(msg, filteredFields...)
+	if !l.logger.Core().Enabled(InfoLevel) || !l.sample(InfoLevel, msg, fields) {
+		return
+	}
+	accums := l.encodeFields(fields, InfoLevel, 1)
+	l.logger.Info(msg, accums.out...)
+	accums.release()
 }
 
 func (l zapECSLogger) Warn(msg string, fields ...zap.Field) {
-	filteredFields := l.encodeFields(fields, WarnLevel)
-	l.logger.Warn(msg, filteredFields...)
+	if !l.logger.Core().Enabled(WarnLevel) || !l.sample(WarnLevel, msg, fields) {
+		return
+	}
+	accums := l.encodeFields(fields, WarnLevel, 1)
+	l.logger.Warn(msg, accums.out...)
+	accums.release()
 }
 
 func (l zapECSLogger) Error(msg string, fields ...zap.Field) {
-	filteredFields := l.encodeFields(fields, ErrorLevel)
-	l.logger.Error(msg, filteredFields...)
+	if !l.logger.Core().Enabled(ErrorLevel) || !l.sample(ErrorLevel, msg, fields) {
+		return
+	}
+	accums := l.encodeFields(fields, ErrorLevel, 1)
+	l.logger.Error(msg, accums.out...)
+	accums.release()
+}
+
+// DPanic, Panic and Fatal entries are always encoded, as zap does not skip them, and never sampled
+
+func (l zapECSLogger) DPanic(msg string, fields ...zap.Field) {
+	if l.development {
+		fields = l.withPanicFields(msg, fields)
+	}
+	accums := l.encodeFields(fields, DPanicLevel, 1)
+	defer accums.release()
+	l.logger.DPanic(msg, accums.out...)
 }
 
 func (l zapECSLogger) Panic(msg string, fields ...zap.Field) {
-	filteredFields := l.encodeFields(fields, PanicLevel)
-	l.logger.Panic(msg, filteredFields...)
+	accums := l.encodeFields(l.withPanicFields(msg, fields), PanicLevel, 1)
+	defer accums.release()
+	l.logger.Panic(msg, accums.out...)
 }
 
 func (l zapECSLogger) Fatal(msg string, fields ...zap.Field) {
-	filteredFields := l.encodeFields(fields, FatalLevel)
-	l.logger.Fatal(msg, filteredFields...)
+	accums := l.encodeFields(fields, FatalLevel, 1)
+	l.writeFatal(msg, accums.out)
+	accums.release()
+	_ = l.flush(1)
+	l.fatalHook()(msg)
 }
 
 func (l zapECSLogger) Flush() error {
+	return l.flush(1)
+}
+
+func (l zapECSLogger) Close() error {
+	if l.sampler != nil {
+		l.sampler.stopSummaries()
+	}
+	return l.flush(1)
+}
+
+// flush writes the pending sampling summary and syncs the logger. skip is the number of
+// frames between the caller and the logger consumer
+func (l zapECSLogger) flush(skip int) error {
+	if l.summaryEnabled() {
+		if summary := l.sampler.flushSummary(); len(summary) > 0 {
+			l.writeSamplingSummary(summary, skip+1)
+		}
+	}
 	return l.logger.Sync()
 }
 
@@ -2,12 +2,18 @@ package zapecs
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 	"unsafe"
@@ -79,6 +85,14 @@ func SanitizeTestTimestamp(data []byte) []byte {
 	return ret
 }
 
+// SanitizeECSTimestamp replaces the @timestamp written by the ECS encoders, which is always
+// the entry time, with a fixed one to allow byte assertions
+func SanitizeECSTimestamp(data []byte) []byte {
+	return ecsTimestampRegexp.ReplaceAll(data, []byte(`"@timestamp":"1990-11-26T17:56:11.000Z"`))
+}
+
+var ecsTimestampRegexp = regexp.MustCompile(`"@timestamp":"[^"]*"`)
+
 func Test_LoggerNoTags(t *testing.T) {
 	// Set up environment
 	prev := os.Getenv("ENVIRONMENT")
@@ -459,3 +473,1357 @@ func Test_LoggerHeaders(t *testing.T) {
 		})
 	}
 }
+
+func Test_LoggerProcess(t *testing.T) {
+	start := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+
+	// Set up log
+	buf, l := NewBufferedLogger(nil, []zap.Field{
+		ecs.ProcessPID(4242),
+		ecs.ProcessName("zap-ecs"),
+		ecs.ProcessStart(start),
+	})
+	// The call fields override the base ones
+	l.duplicatePolicy = DuplicateLastWins
+
+	testName := "process_fields"
+	t.Run(testName, func(t *testing.T) {
+		buf.Truncate(0)
+		l.Info("this is a test message",
+			ecs.ProcessPID(42),
+			ecs.ProcessPPID(1),
+			ecs.ProcessExecutable("/usr/local/bin/zap-ecs"),
+			ecs.ProcessArgs([]string{"/usr/local/bin/zap-ecs", "-v"}),
+			ecs.ProcessWorkingDirectory("/tmp"),
+			ecs.ProcessThreadID(4243),
+			ecs.ProcessTitle("zap-ecs"),
+			ecs.ProcessExitCode(0),
+			ecs.ProcessEnd(start.Add(time.Hour)),
+		)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+
+	t.Run("current_process", func(t *testing.T) {
+		buf, l := NewBufferedLogger(nil, ecs.CurrentProcess())
+		l.Info("this is a test message")
+
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		process, _ := entry[ecs.ProcessBaseLevelKey].(map[string]interface{})
+		if pid, _ := process["pid"].(float64); int(pid) != os.Getpid() {
+			t.Errorf("expected process.pid %v, got %v", os.Getpid(), process["pid"])
+		}
+		if _, found := process["executable"]; !found {
+			t.Errorf("expected process.executable to be set, got %v", process)
+		}
+		if thread, found := process["thread"]; found {
+			t.Errorf("expected no process.thread, got %v", thread)
+		}
+		// The start time is read from procfs on linux, with a precision of a second (the boot time)
+		if runtime.GOOS == "linux" {
+			seconds, _ := process["start"].(float64)
+			if start := time.Unix(int64(seconds), 0); start.After(time.Now().Add(time.Second)) || start.Before(time.Now().Add(-time.Hour)) {
+				t.Errorf("expected process.start to be the process start time, got %v", process["start"])
+			}
+		}
+	})
+
+	t.Run("child_process", func(t *testing.T) {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		buf, l := NewBufferedLogger(nil, nil)
+		l.Info("this is a test message", ecs.ProcessFromCmd(cmd)...)
+
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		process, _ := entry[ecs.ProcessBaseLevelKey].(map[string]interface{})
+		if pid, _ := process["pid"].(float64); int(pid) != cmd.ProcessState.Pid() {
+			t.Errorf("expected process.pid %v, got %v", cmd.ProcessState.Pid(), process["pid"])
+		}
+		if exitCode, found := process["exit_code"]; !found || exitCode.(float64) != 0 {
+			t.Errorf("expected process.exit_code 0, got %v", exitCode)
+		}
+		if ppid, _ := process["ppid"].(float64); int(ppid) != os.Getpid() {
+			t.Errorf("expected process.ppid %v, got %v", os.Getpid(), process["ppid"])
+		}
+		// The end time is unknown to the command
+		if end, found := process["end"]; found {
+			t.Errorf("expected no process.end, got %v", end)
+		}
+	})
+}
+
+func Test_LoggerKubernetes(t *testing.T) {
+	// Set up log
+	buf, l := NewBufferedLogger(nil, []zap.Field{
+		ecs.ContainerID("2f4a3bb9b3c0"),
+		ecs.ContainerName("api"),
+		ecs.ContainerImageName("acme/api"),
+		ecs.ContainerImageTag([]string{"1.2.3"}),
+		ecs.OrchestratorType("kubernetes"),
+		ecs.OrchestratorNamespace("production"),
+		ecs.OrchestratorResourceType("pod"),
+		ecs.OrchestratorResourceName("api-6d4cf56db6-abcde"),
+		ecs.KubernetesNamespace("production"),
+		ecs.KubernetesPodName("api-6d4cf56db6-abcde"),
+		ecs.KubernetesPodUID("7d3f1a2b-4c5d-6e7f-8a9b-0c1d2e3f4a5b"),
+		ecs.KubernetesPodIP("10.1.2.3"),
+		ecs.KubernetesNodeName("node-1"),
+	})
+
+	testName := "kubernetes_base_fields"
+	t.Run(testName, func(t *testing.T) {
+		buf.Truncate(0)
+		l.Info("this is a test message", zap.String("foo", "a"))
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+}
+
+func Test_LoggerUser(t *testing.T) {
+	user := ecs.UserInfo{
+		ID:        "S-1-5-21-202424912787-2692429404-2351956786-1000",
+		Name:      "alice",
+		FullName:  "Alice Doe",
+		Email:     "alice@example.com",
+		Domain:    "EXAMPLE",
+		Roles:     []string{"admin", "auditor"},
+		GroupID:   "42",
+		GroupName: "admins",
+	}
+	fields := append(ecs.User(user),
+		ecs.UserTarget(ecs.UserInfo{ID: "1001", Name: "bob", Email: "bob@example.com"})...)
+	fields = append(fields, ecs.UserEffective(ecs.UserInfo{ID: "0", Name: "root"})...)
+	fields = append(fields, ecs.UserChanges(ecs.UserInfo{Name: "robert"})...)
+	fields = append(fields,
+		ecs.GroupID("42"),
+		ecs.GroupName("admins"),
+		ecs.OrganizationID("acme-id"),
+		ecs.OrganizationName("ACME"),
+	)
+
+	policies := map[string]PIIPolicy{
+		"user_fields_pii_keep": PIIKeep,
+		"user_fields_pii_hash": PIIHash,
+		"user_fields_pii_drop": PIIDrop,
+	}
+	for testName, policy := range policies {
+		testName, policy := testName, policy
+		t.Run(testName, func(t *testing.T) {
+			buf, l := NewBufferedLogger(nil, []zap.Field{ecs.OrganizationName("ACME")})
+			l.piiPolicy = policy
+			l.piiFields = newPIIFieldSet(nil)
+
+			l.Info("this is a test message", fields...)
+			test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+		})
+	}
+
+	testName := "user_fields_pii_hmac"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := NewBufferedLogger(nil, []zap.Field{ecs.OrganizationName("ACME")})
+		l.piiPolicy = PIIHash
+		l.piiFields = newPIIFieldSet(nil)
+		l.piiHashKey = []byte("secret")
+
+		l.Info("this is a test message", fields...)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+
+		// The keyed hash differs from the plain one
+		if hash := hashPIIValue(ecs.UserEmail("alice@example.com"), nil); strings.Contains(buf.String(), hash) {
+			t.Fatalf("expected the keyed hash, got the plain one in %v", buf.String())
+		}
+	})
+}
+
+func Test_LoggerEvent(t *testing.T) {
+	start := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+
+	// Set up log
+	buf, l := NewBufferedLogger(nil, nil)
+
+	testName := "all_event_fields"
+	t.Run(testName, func(t *testing.T) {
+		buf.Truncate(0)
+		l.Info("this is a test message",
+			ecs.EventID("8a4f500d"),
+			ecs.EventCode("4648"),
+			ecs.EventKindOf(ecs.EventKindEvent),
+			ecs.EventCategories(ecs.EventCategoryAuthentication, ecs.EventCategoryIAM),
+			ecs.EventTypes(ecs.EventTypeStart, ecs.EventTypeUser),
+			ecs.EventOutcomeOf(ecs.EventOutcomeSuccess),
+			ecs.EventAction("user-login"),
+			ecs.EventDuration(1532*time.Millisecond),
+			ecs.EventStart(start),
+			ecs.EventEnd(start.Add(1532*time.Millisecond)),
+			ecs.EventCreated(start),
+			ecs.EventIngested(start),
+			ecs.EventSequence(42),
+			ecs.EventSeverity(3),
+			ecs.EventRiskScore(21.5),
+			ecs.EventReason("valid credentials"),
+			ecs.EventReference("https://system.example.com/event/#0001234"),
+			ecs.EventDataset("auth.log"),
+			ecs.EventProvider("kernel"),
+			ecs.EventTimezone("-03:00"),
+			ecs.EventHash("123456789012345678901234567890ABCD"),
+		)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+
+	t.Run("validation_warn", func(t *testing.T) {
+		buf.Truncate(0)
+		l.eventValidation = EventValidationWarn
+		defer func() { l.eventValidation = EventValidationNone }()
+
+		l.Info("this is a test message", ecs.EventKind("test"), ecs.EventOutcomeOf(ecs.EventOutcomeSuccess))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected a warning and the entry, got %v", lines)
+		}
+		if !strings.Contains(lines[0], invalidFieldMessage) || !strings.Contains(lines[0], `\"test\" is not an allowed value of event.kind`) {
+			t.Errorf("unexpected warning entry %v", lines[0])
+		}
+		if !strings.Contains(lines[1], `"kind":"test"`) {
+			t.Errorf("expected invalid value to be kept, got %v", lines[1])
+		}
+	})
+
+	t.Run("validation_warn_context", func(t *testing.T) {
+		// Invalid base labels and With context fields are reported once per entry
+		buf, l := NewBufferedLogger(nil, []zap.Field{zap.String(ecs.FieldEventOutcome, "bogus")})
+		l.eventValidation = EventValidationWarn
+
+		l.With(zap.String(ecs.FieldEventKind, "bogus")).Info("this is a test message")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected 2 warnings and the entry, got %v", lines)
+		}
+		for i, key := range []string{ecs.FieldEventOutcome, ecs.FieldEventKind} {
+			if !strings.Contains(lines[i], invalidFieldMessage) || !strings.Contains(lines[i], `is not an allowed value of `+key) {
+				t.Errorf("unexpected warning entry %v", lines[i])
+			}
+		}
+		if !strings.Contains(lines[2], `"kind":"bogus"`) || !strings.Contains(lines[2], `"outcome":"bogus"`) {
+			t.Errorf("expected invalid values to be kept, got %v", lines[2])
+		}
+	})
+
+	t.Run("validation_reject", func(t *testing.T) {
+		buf.Truncate(0)
+		l.eventValidation = EventValidationReject
+		defer func() { l.eventValidation = EventValidationNone }()
+
+		l.Info("this is a test message", ecs.EventKind("test"), ecs.EventCategories(ecs.EventCategoryWeb, "test"), ecs.EventOutcomeOf(ecs.EventOutcomeSuccess))
+
+		if !strings.Contains(buf.String(), `"event":{"outcome":"success"}`) {
+			t.Errorf("expected invalid event fields to be omitted, got %v", buf.String())
+		}
+	})
+}
+
+func Test_LoggerOrigin(t *testing.T) {
+	// Set up log
+	buf, l := NewBufferedLogger(nil, nil)
+	l.originLevel = zap.ErrorLevel
+
+	decodeLog := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		log, _ := entry[ecs.LogBaseLevelKey].(map[string]interface{})
+		return log
+	}
+
+	t.Run("enabled_level", func(t *testing.T) {
+		buf.Truncate(0)
+		_, file, line, _ := runtime.Caller(0)
+		l.Error("this is a test message")
+
+		origin, _ := decodeLog(t)["origin"].(map[string]interface{})
+		originFile, _ := origin["file"].(map[string]interface{})
+		if name, _ := originFile["name"].(string); name == "" || !strings.HasSuffix(file, name) || !strings.HasSuffix(name, "/logger_test.go") {
+			t.Errorf("unexpected log.origin.file.name %v", originFile["name"])
+		}
+		if originLine, _ := originFile["line"].(float64); int(originLine) != line+1 {
+			t.Errorf("expected log.origin.file.line %v, got %v", line+1, originFile["line"])
+		}
+		if function, _ := origin["function"].(string); !strings.HasSuffix(function, "Test_LoggerOrigin.func2") {
+			t.Errorf("unexpected log.origin.function %v", origin["function"])
+		}
+	})
+
+	t.Run("disabled_level", func(t *testing.T) {
+		buf.Truncate(0)
+		l.Info("this is a test message")
+
+		if origin, found := decodeLog(t)["origin"]; found {
+			t.Errorf("expected no log.origin, got %v", origin)
+		}
+	})
+
+	t.Run("zap_caller", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		encoderConfig := buildLoggerConfig().EncoderConfig
+		encoderConfig.CallerKey = "caller"
+		core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zap.DebugLevel)
+		l := NewECSLogger(Options{Logger: zap.New(core, zap.AddCaller())})
+
+		l.Info("this is a test message")
+		if !strings.Contains(buf.String(), "/logger_test.go:") {
+			t.Errorf("expected zap caller to point to the consumer, got %v", buf.String())
+		}
+	})
+}
+
+func Test_LoggerOriginCallSites(t *testing.T) {
+	now := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+	newOriginLogger := func() (*bytes.Buffer, *zapECSLogger) {
+		buf, l := NewBufferedLogger(nil, nil)
+		l.originLevel = zap.DebugLevel
+		return buf, l
+	}
+	// assertOrigin asserts the log.origin of the entries, with the line replaced by its offset
+	// from the expected call line and the file by its name, so that the goldens do not depend
+	// on the file layout nor the checkout directory
+	assertOrigin := func(t *testing.T, testName string, buf *bytes.Buffer, line int) {
+		t.Helper()
+		origins := []interface{}{}
+		for _, data := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			entry := EntryFields{}
+			if err := json.Unmarshal(data, &entry); err != nil {
+				t.Fatal(err)
+			}
+			origin, _ := entry.Value("log.origin")
+			if object, ok := origin.(map[string]interface{}); ok {
+				if file, ok := object["file"].(map[string]interface{}); ok {
+					if originLine, ok := file["line"].(float64); ok {
+						file["line"] = int(originLine) - line
+					}
+					if name, ok := file["name"].(string); ok {
+						file["name"] = name[strings.LastIndexByte(name, '/')+1:]
+					}
+				}
+			}
+			origins = append(origins, map[string]interface{}{"message": entry["message"], "origin": origin})
+		}
+		out, _ := json.Marshal(map[string]interface{}{"entries": origins})
+		test.AssertBytesAsJSON(t, testName, out)
+	}
+
+	testName := "origin_validation_warning"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := newOriginLogger()
+		l.eventValidation = EventValidationWarn
+
+		_, _, line, _ := runtime.Caller(0)
+		l.Info("this is a test message", ecs.EventKind("bogus"))
+		assertOrigin(t, testName, buf, line+1)
+	})
+
+	testName = "origin_sampling_summary"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := newOriginLogger()
+		l.sampler = newSampler(&SamplingOptions{First: 1, SummaryInterval: time.Minute})
+		l.sampler.now = func() time.Time { return now }
+		l.Info("request failed")
+		l.Info("request failed")
+		buf.Reset()
+
+		// The summary is written along with the entry following the summary interval
+		l.sampler.now = func() time.Time { return now.Add(time.Minute) }
+		_, _, line, _ := runtime.Caller(0)
+		l.Info("request served")
+		assertOrigin(t, testName, buf, line+1)
+	})
+
+	testName = "origin_sampling_flush"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := newOriginLogger()
+		l.sampler = newSampler(&SamplingOptions{First: 1, SummaryInterval: time.Minute})
+		l.sampler.now = func() time.Time { return now }
+		l.Info("request failed")
+		l.Info("request failed")
+		buf.Reset()
+
+		_, _, line, _ := runtime.Caller(0)
+		_ = l.Flush()
+		assertOrigin(t, testName, buf, line+1)
+	})
+
+	testName = "origin_recover"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := newOriginLogger()
+
+		var line int
+		func() {
+			defer RecoverAndLog(l, RecoverOptions{})
+			_, _, line, _ = runtime.Caller(0)
+			panic("boom")
+		}()
+		assertOrigin(t, testName, buf, line+1)
+	})
+
+	testName = "origin_recover_middleware"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := newOriginLogger()
+
+		var line int
+		handler := RecoverMiddleware(l, RecoverOptions{})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			_, _, line, _ = runtime.Caller(0)
+			panic("boom")
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assertOrigin(t, testName, buf, line+1)
+	})
+}
+
+func Test_LoggerStacktrace(t *testing.T) {
+	// Set up log
+	buf, l := NewBufferedLogger(nil, nil)
+	l.stacktraceLevel = zap.ErrorLevel
+
+	decodeStacktrace := func(t *testing.T) (string, bool) {
+		t.Helper()
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		errorObject, _ := entry[ecs.ErrorBaseLevelKey].(map[string]interface{})
+		stack, found := errorObject["stack_trace"].(string)
+		return stack, found
+	}
+
+	t.Run("compact", func(t *testing.T) {
+		buf.Truncate(0)
+		l.Error("this is a test message")
+
+		stack, _ := decodeStacktrace(t)
+		if !strings.HasPrefix(stack, "github.com/lggomez/zap-ecs.Test_LoggerStacktrace.func2\n\t") {
+			t.Errorf("expected the stack trace to start on the consumer frame, got %v", stack)
+		}
+		if strings.Contains(stack, "go.uber.org/zap") || strings.Contains(stack, "stacktrace.go") {
+			t.Errorf("expected no library frames, got %v", stack)
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		buf.Truncate(0)
+		l.stacktraceFormat = StacktraceFull
+		defer func() { l.stacktraceFormat = StacktraceCompact }()
+		l.Error("this is a test message")
+
+		stack, _ := decodeStacktrace(t)
+		lines := strings.Split(stack, "\n")
+		if len(lines) < 3 || !strings.HasPrefix(lines[0], "goroutine ") || !strings.HasPrefix(lines[1], "github.com/lggomez/zap-ecs.Test_LoggerStacktrace.func3") {
+			t.Errorf("expected a debug.Stack trace starting on the consumer frame, got %v", stack)
+		}
+	})
+
+	t.Run("size_cap", func(t *testing.T) {
+		buf.Truncate(0)
+		l.stacktraceMaxSize = 100
+		defer func() { l.stacktraceMaxSize = 0 }()
+		l.Error("this is a test message")
+
+		stack, _ := decodeStacktrace(t)
+		if len(stack) > 100+len(stacktraceTruncatedMark) || !strings.HasSuffix(stack, stacktraceTruncatedMark) {
+			t.Errorf("expected a truncated stack trace, got %v", stack)
+		}
+	})
+
+	t.Run("disabled_level", func(t *testing.T) {
+		buf.Truncate(0)
+		l.Warn("this is a test message")
+
+		if stack, found := decodeStacktrace(t); found {
+			t.Errorf("expected no stack trace, got %v", stack)
+		}
+	})
+
+	t.Run("explicit_stack_trace", func(t *testing.T) {
+		buf.Truncate(0)
+		l.Error("this is a test message", zap.String(ecs.FieldStackTrace, mockStackTrace))
+
+		if stack, _ := decodeStacktrace(t); stack != mockStackTrace {
+			t.Errorf("expected the entry stack trace to be kept, got %v", stack)
+		}
+	})
+}
+
+type syncCounterWriteSyncer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (s *syncCounterWriteSyncer) Sync() error {
+	s.syncs++
+	return nil
+}
+
+func Test_LoggerPanicFatal(t *testing.T) {
+	newLogger := func(o Options) (*syncCounterWriteSyncer, Logger) {
+		ws := &syncCounterWriteSyncer{}
+		jsonEncoder := zapcore.NewJSONEncoder(buildLoggerConfig().EncoderConfig)
+		o.Logger = zap.New(zapcore.NewCore(jsonEncoder, ws, zap.DebugLevel))
+		o.BaseLoggerField = baseLoggerField
+		return ws, NewECSLogger(o)
+	}
+
+	t.Run("panic", func(t *testing.T) {
+		ws, l := newLogger(Options{})
+		func() {
+			defer func() {
+				if r := recover(); r != "this is a test message" {
+					t.Errorf("expected the logger to panic with the message, got %v", r)
+				}
+			}()
+			l.Panic("this is a test message", zap.String("foo", "a"))
+		}()
+		test.AssertBytesAsJSON(t, "panic", SanitizeTestTimestamp(ws.Bytes()))
+	})
+
+	t.Run("dpanic_production", func(t *testing.T) {
+		ws, l := newLogger(Options{})
+		l.DPanic("this is a test message")
+		test.AssertBytesAsJSON(t, "dpanic_production", SanitizeTestTimestamp(ws.Bytes()))
+	})
+
+	t.Run("dpanic_development", func(t *testing.T) {
+		ws, l := newLogger(Options{Development: true})
+		func() {
+			defer func() {
+				if r := recover(); r != "this is a test message" {
+					t.Errorf("expected the logger to panic with the message, got %v", r)
+				}
+			}()
+			l.DPanic("this is a test message", zap.String(ecs.FieldErrorType, "custom"))
+		}()
+		test.AssertBytesAsJSON(t, "dpanic_development", SanitizeTestTimestamp(ws.Bytes()))
+	})
+
+	for _, policy := range []DuplicatePolicy{DuplicateLastWins, DuplicateCollect} {
+		policy := policy
+		t.Run(fmt.Sprintf("panic_user_error_%d", policy), func(t *testing.T) {
+			// The user supplied error fields are kept as they are
+			ws, l := newLogger(Options{DuplicatePolicy: policy})
+			func() {
+				defer func() { _ = recover() }()
+				l.With(zap.String(ecs.FieldErrorMessage, "connection reset")).
+					Panic("this is a test message", zap.String(ecs.FieldErrorType, "*net.OpError"))
+			}()
+			if expected := `"error":{"message":"connection reset","type":"*net.OpError"}`; !strings.Contains(ws.String(), expected) {
+				t.Errorf("expected %v in %v", expected, ws.String())
+			}
+			if !strings.Contains(ws.String(), `"event":{"kind":"event"}`) {
+				t.Errorf("expected the missing panic fields to be added, got %v", ws.String())
+			}
+		})
+	}
+
+	t.Run("panic_provided_error", func(t *testing.T) {
+		// The provided labels are kept as well, without adding a duplicated panic field
+		ws, l := newLogger(Options{
+			DuplicatePolicy: DuplicateCollect,
+			LabelProviders: []LabelProvider{LabelProviderFunc(func() []zap.Field {
+				return []zap.Field{zap.String(ecs.FieldErrorType, "provided")}
+			})},
+		})
+		func() {
+			defer func() { _ = recover() }()
+			l.Panic("this is a test message")
+		}()
+		if expected := `"type":"provided"`; !strings.Contains(ws.String(), expected) {
+			t.Errorf("expected %v in %v", expected, ws.String())
+		}
+	})
+
+	t.Run("fatal_hook", func(t *testing.T) {
+		hookMsg := ""
+		ws, l := newLogger(Options{OnFatal: func(msg string) { hookMsg = msg }})
+		l.Fatal("this is a test message", zap.String("foo", "a"))
+
+		if hookMsg != "this is a test message" {
+			t.Errorf("expected the fatal hook to be run, got %v", hookMsg)
+		}
+		if ws.syncs == 0 {
+			t.Errorf("expected the logger to be flushed before the fatal hook")
+		}
+		test.AssertBytesAsJSON(t, "fatal_hook", SanitizeTestTimestamp(ws.Bytes()))
+	})
+
+	t.Run("fatal_noop", func(t *testing.T) {
+		ws, l := newLogger(Options{OnFatal: FatalNoop})
+		l.Fatal("this is a test message")
+		if !strings.Contains(ws.String(), `"level":"fatal"`) {
+			t.Errorf("expected the fatal entry to be written, got %v", ws.String())
+		}
+	})
+}
+
+func Test_RecoverAndLog(t *testing.T) {
+	newLogger := func() (*syncCounterWriteSyncer, Logger) {
+		ws := &syncCounterWriteSyncer{}
+		jsonEncoder := zapcore.NewJSONEncoder(buildLoggerConfig().EncoderConfig)
+		return ws, NewECSLogger(Options{
+			Logger:          zap.New(zapcore.NewCore(jsonEncoder, ws, zap.DebugLevel)),
+			BaseLoggerField: baseLoggerField,
+		})
+	}
+	assertCrashEvent := func(t *testing.T, ws *syncCounterWriteSyncer, errType, errMessage string) map[string]interface{} {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(ws.Bytes(), &entry); err != nil {
+			t.Fatalf("unexpected error decoding the log entry: %v", err)
+		}
+		if ws.syncs == 0 {
+			t.Errorf("expected the logger to be flushed")
+		}
+		errObj, _ := entry["error"].(map[string]interface{})
+		if errObj["type"] != errType || errObj["message"] != errMessage {
+			t.Errorf("unexpected error fields %v", errObj)
+		}
+		if stack, _ := errObj["stack_trace"].(string); !strings.HasPrefix(stack, "github.com/lggomez/zap-ecs.Test_RecoverAndLog") {
+			t.Errorf("expected the stack trace to start on the panicking function, got %v", stack)
+		}
+		event, _ := entry["event"].(map[string]interface{})
+		if event["kind"] != "event" || event["outcome"] != "failure" {
+			t.Errorf("unexpected event fields %v", event)
+		}
+		return entry
+	}
+
+	t.Run("recover", func(t *testing.T) {
+		ws, l := newLogger()
+		func() {
+			defer RecoverAndLog(l, RecoverOptions{})
+			panic(errors.New("this is a test error"))
+		}()
+		entry := assertCrashEvent(t, ws, "*errors.errorString", "this is a test error")
+		if entry["message"] != defaultRecoverMessage || entry["log"].(map[string]interface{})["level"] != "error" {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("repanic", func(t *testing.T) {
+		ws, l := newLogger()
+		func() {
+			defer func() {
+				if r := recover(); r != 42 {
+					t.Errorf("expected the panic to be propagated, got %v", r)
+				}
+			}()
+			lvl := WarnLevel
+			defer RecoverAndLog(l, RecoverOptions{Message: "crash", Level: &lvl, Repanic: true})
+			panic(42)
+		}()
+		entry := assertCrashEvent(t, ws, "int", "42")
+		if entry["message"] != "crash" || entry["log"].(map[string]interface{})["level"] != "warn" {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		ws, l := newLogger()
+		handler := RecoverMiddleware(l, RecoverOptions{})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("this is a test message")
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code 500, got %v", rec.Code)
+		}
+		assertCrashEvent(t, ws, "string", "this is a test message")
+	})
+}
+
+func Test_LoggerLabelsPolicy(t *testing.T) {
+	fields := []zap.Field{
+		zap.Bool("bool_example", true),
+		zap.Int("int_example", 42),
+		zap.Uint8("uint8_example", 42),
+		zap.Float64("float64_example", 1.5),
+		zap.Duration("duration_example", 1532*time.Millisecond),
+		zap.Time("time_example", time.Date(1990, time.November, 26, 17, 56, 11, 31, time.UTC)),
+		zap.Stringer("stringer_example", &stringerMock{}),
+		zap.Reflect("reflect_example", 42),
+		zap.String("string_example", "foo"),
+		zap.Strings("strings_example", []string{"foo", "bar"}),
+		zap.Any("any_example", map[string]interface{}{"foo": 42}),
+		zap.Any("nested.any_example", map[string]interface{}{"foo": 42}),
+	}
+
+	testName := "labels_keyword_custom_namespace"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := NewBufferedLogger(nil, nil)
+		l.labels = newLabelsConfig(LabelsKeyword, "myapp")
+
+		l.Info("this is a test message", fields...)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+		if dropped := l.DroppedLabels(); dropped != 0 {
+			t.Errorf("expected no dropped labels, got %v", dropped)
+		}
+	})
+
+	testName = "labels_keyword_drop"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := NewBufferedLogger(nil, nil)
+		l.labels = newLabelsConfig(LabelsKeyword, "")
+
+		l.Info("this is a test message", fields...)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+		if dropped := l.DroppedLabels(); dropped != 3 {
+			t.Errorf("expected 3 dropped labels, got %v", dropped)
+		}
+	})
+}
+
+func Test_LoggerCustomNamespaces(t *testing.T) {
+	routes := map[string]string{"order.*": "order", "cart": "shopping_cart", "cart.items.": "cart_items"}
+	fields := []zap.Field{
+		zap.String("order.id", "o-42"),
+		zap.String("cart.id", "c-42"),
+		zap.Int("cart.items.count", 3),
+		zap.String("request.id", "r-42"),
+		zap.String("foo", "bar"),
+	}
+	baseLabels := []zap.Field{zap.String("order.channel", "web"), zap.String("environment", "test-environment")}
+
+	testName := "custom_namespaces"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := NewBufferedLogger(nil, baseLabels)
+		l.namespaces = newCustomNamespaces(routes, "")
+
+		l.Info("this is a test message", fields...)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+
+	testName = "custom_namespaces_leaf_conflict"
+	t.Run(testName, func(t *testing.T) {
+		// Keys that are both a value and the path of other fields keep the value under _value
+		buf, l := NewBufferedLogger(nil, nil)
+		l.namespaces = newCustomNamespaces(routes, "")
+
+		l.Info("this is a test message",
+			zap.String("order.request", "r-42"),
+			zap.String("order.request.id", "42"),
+			zap.String("order.request.source.ip", "10.0.0.1"),
+			zap.String("order.request.source", "internal"),
+			ecs.EventAction("order-created"),
+			zap.String("event.action.reason", "checkout"),
+		)
+		for _, key := range []string{"request", "source", "action"} {
+			if count := strings.Count(buf.String(), fmt.Sprintf("%q:", key)); count != 1 {
+				t.Errorf("expected key %v to be encoded once, got %v in %v", key, count, buf.String())
+			}
+		}
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+
+	testName = "custom_namespaces_default"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := NewBufferedLogger(nil, baseLabels)
+		l.namespaces = newCustomNamespaces(routes, "myapp")
+
+		l.Info("this is a test message", fields...)
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+
+	testName = "custom_namespaces_reserved"
+	t.Run(testName, func(t *testing.T) {
+		// Objects named as ECS field sets or root keys are rejected, so their fields go to labels
+		buf, l := NewBufferedLogger(nil, baseLabels)
+		l.namespaces = newCustomNamespaces(map[string]string{"order": "event", "cart": "shopping_cart"}, ecs.FieldLabels)
+
+		l.Info("this is a test message", fields...)
+		for _, key := range []string{ecs.EventBaseLevelKey, ecs.FieldLabels} {
+			if count := strings.Count(buf.String(), fmt.Sprintf("%q:", key)); count != 1 {
+				t.Errorf("expected key %v to be encoded once, got %v in %v", key, count, buf.String())
+			}
+		}
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+}
+
+func Test_LoggerDuplicates(t *testing.T) {
+	baseLabels := []zap.Field{
+		zap.String(ecs.FieldLabelEnvironment, "base-env-1"),
+		zap.String(ecs.FieldLabelEnvironment, "base-env-2"),
+		ecs.Tags([]string{"base-tag"}),
+		ecs.ProcessPID(1),
+	}
+
+	policies := map[string]DuplicatePolicy{
+		"duplicates_first_wins": DuplicateFirstWins,
+		"duplicates_last_wins":  DuplicateLastWins,
+		"duplicates_collect":    DuplicateCollect,
+		"duplicates_count":      DuplicateCount,
+	}
+	for testName, policy := range policies {
+		testName, policy := testName, policy
+		t.Run(testName, func(t *testing.T) {
+			buf, l := NewBufferedLogger(nil, baseLabels)
+			l.duplicatePolicy = policy
+			l.duplicates = new(uint64)
+
+			child := l.With(ecs.ProcessPID(2), zap.String("foo", "ctx"))
+			child.Info("this is a test message",
+				zap.String("foo", "a"),
+				zap.String("foo", "b"),
+				ecs.Tags([]string{"tag1"}),
+				ecs.ProcessPID(3),
+			)
+			// Golden files are compared as decoded JSON, so assert the raw keys are not repeated
+			for _, key := range []string{ecs.FieldLabelEnvironment, ecs.FieldTags, ecs.ProcessBaseLevelKey} {
+				if count := strings.Count(buf.String(), fmt.Sprintf("%q:", key)); count != 1 {
+					t.Errorf("expected key %v to be encoded once, got %v", key, count)
+				}
+			}
+			test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+
+			expectedDuplicates := uint64(0)
+			if policy == DuplicateCount {
+				expectedDuplicates = 5
+			}
+			if duplicates := child.(LoggerStats).DuplicateFields(); duplicates != expectedDuplicates {
+				t.Errorf("expected %v duplicate fields, got %v", expectedDuplicates, duplicates)
+			}
+		})
+	}
+}
+
+func Test_LoggerDuplicateWrittenKeys(t *testing.T) {
+	baseLabels := []zap.Field{
+		zap.String("labels.id", "base"),
+		zap.String(ecs.FieldLabels, "base"),
+		zap.String("foo", "base"),
+		zap.String("error.cause.code", "base"),
+	}
+	buf, l := NewBufferedLogger(nil, baseLabels)
+	l.duplicatePolicy = DuplicateLastWins
+
+	// Duplicates are resolved on the keys as written: labels.id and id are both written to
+	// labels, while error.cause.code and error.code are both written to error
+	l.Info("this is a test message",
+		zap.String("id", "call"),
+		zap.String("foo", "call"),
+		zap.String("error.code", "call"),
+	)
+	for _, key := range []string{"id", "foo", "code"} {
+		if count := strings.Count(buf.String(), fmt.Sprintf("%q:", key)); count != 1 {
+			t.Errorf("expected key %v to be encoded once, got %v in %v", key, count, buf.String())
+		}
+	}
+	// The base label colliding with the root labels object is added to it
+	if count := strings.Count(buf.String(), `"labels":`); count != 2 || !strings.Contains(buf.String(), `"labels":"base"`) {
+		t.Errorf("expected the labels base label inside the labels object, got %v", buf.String())
+	}
+
+	testName := "duplicate_written_keys"
+	t.Run(testName, func(t *testing.T) {
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+}
+
+func Test_LoggerTags(t *testing.T) {
+	policies := map[string]DuplicatePolicy{
+		"tags_merged_first_wins": DuplicateFirstWins,
+		"tags_merged_last_wins":  DuplicateLastWins,
+		"tags_merged_collect":    DuplicateCollect,
+		"tags_merged_count":      DuplicateCount,
+	}
+	for testName, policy := range policies {
+		testName, policy := testName, policy
+		t.Run(testName, func(t *testing.T) {
+			// Tags from every source are merged regardless of the duplicate policy
+			buf, l := NewBufferedLogger([]string{"env"}, []zap.Field{ecs.Tag("base")})
+			l.duplicatePolicy = policy
+
+			l.WithTags("child").With(ecs.Tag("ctx")).Info("this is a test message",
+				ecs.Tag("call-1"),
+				ecs.Tag("call-2"),
+				zap.Strings(ecs.FieldTags, []string{"call-3"}),
+			)
+			test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+		})
+	}
+
+	tagFields := map[string]zap.Field{
+		"tags_ecs_tags":    ecs.Tags([]string{"b", "a", "child"}),
+		"tags_ecs_tag":     ecs.Tag("b", "a", "child"),
+		"tags_zap_strings": zap.Strings(ecs.FieldTags, []string{"b", "a", "child"}),
+		"tags_zap_string":  zap.String(ecs.FieldTags, "b"),
+		"tags_wrong_type":  zap.Int(ecs.FieldTags, 42),
+	}
+	for testName, field := range tagFields {
+		testName, field := testName, field
+		t.Run(testName, func(t *testing.T) {
+			buf, l := NewBufferedLogger([]string{"env", " env ", ""}, nil)
+
+			l.WithTags("child", "env").Info("this is a test message", field)
+			test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+		})
+	}
+
+	testName := "tags_sorted"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := NewBufferedLogger([]string{"env"}, nil)
+		l.sortTags = true
+
+		l.Info("this is a test message", ecs.Tag("b", "a", "env"))
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+}
+
+func Test_LoggerLabelProviders(t *testing.T) {
+	role := "follower"
+	evaluations := 0
+	provider := LabelProviderFunc(func() []zap.Field {
+		evaluations++
+		return []zap.Field{zap.String("role", role)}
+	})
+
+	now := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+	cached := CachedLabelProvider(provider, time.Minute).(*cachedLabelProvider)
+	cached.now = func() time.Time { return now }
+
+	buf, l := NewBufferedLogger(nil, nil)
+	l.labelProviders = []LabelProvider{cached}
+	entryRole := func() interface{} {
+		defer buf.Truncate(0)
+		l.Info("this is a test message")
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("unexpected error decoding the log entry: %v", err)
+		}
+		return entry["role"]
+	}
+
+	if r := entryRole(); r != "follower" {
+		t.Errorf("expected the provided role label, got %v", r)
+	}
+
+	// The cached labels are kept until the ttl expires
+	role = "leader"
+	if r := entryRole(); r != "follower" || evaluations != 1 {
+		t.Errorf("expected the cached role label after %v evaluations, got %v", evaluations, r)
+	}
+
+	now = now.Add(time.Minute)
+	if r := entryRole(); r != "leader" || evaluations != 2 {
+		t.Errorf("expected the refreshed role label after %v evaluations, got %v", evaluations, r)
+	}
+
+	// Entry fields override the provided labels under DuplicateLastWins
+	l.duplicatePolicy = DuplicateLastWins
+	l.Info("this is a test message", zap.String("role", "candidate"))
+	if strings.Contains(buf.String(), `"role":"leader"`) {
+		t.Errorf("expected the entry field to override the provided label, got %v", buf.String())
+	}
+}
+
+func Test_LoggerPooledAccumulators(t *testing.T) {
+	buf, l := NewBufferedLogger([]string{"env"}, nil)
+	l.namespaces = newCustomNamespaces(map[string]string{"order": "order"}, "")
+	freshBuf, fresh := NewBufferedLogger([]string{"env"}, nil)
+	fresh.Info("this is a test message")
+
+	// Entries must not carry over any state from the pooled accumulators of previous entries
+	for i := 0; i < 3; i++ {
+		l.Info("this is a test message",
+			zap.String("order.id", "o-42"),
+			ecs.ProcessPID(42),
+			ecs.Tag("tag1"),
+			ecs.HTTPRequestMethod("GET"),
+			zap.String("foo", "bar"),
+		)
+		buf.Truncate(0)
+
+		l.Info("this is a test message")
+		if got, expected := string(SanitizeTestTimestamp(buf.Bytes())), string(SanitizeTestTimestamp(freshBuf.Bytes())); got != expected {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		buf.Truncate(0)
+	}
+}
+
+func Test_LoggerECSEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	// The production config encodes time as epoch, while @timestamp is always ISO 8601
+	enc := ecs.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	l := NewECSLogger(Options{
+		BaseLoggerField: baseLoggerField,
+		BaseTags:        []string{"env"},
+		Logger:          zap.New(zapcore.NewCore(enc, zapcore.AddSync(buf), zap.DebugLevel)),
+	})
+
+	testName := "ecs_encoder"
+	t.Run(testName, func(t *testing.T) {
+		l.Info("this is a test message", ecs.EventAction("test-started"), zap.String("foo", "bar"))
+		if !ecsTimestampRegexp.Match(buf.Bytes()) {
+			t.Fatalf("expected an ISO 8601 @timestamp, got %v", buf.String())
+		}
+		test.AssertBytes(t, testName, SanitizeECSTimestamp(buf.Bytes()))
+	})
+}
+
+func Test_LoggerHTTPConsoleEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "message"})
+	l := NewECSLogger(Options{
+		Logger: zap.New(zapcore.NewCore(enc, zapcore.AddSync(buf), zap.DebugLevel)),
+	})
+
+	// The http object must be encoded natively rather than as a serialized JSON byte dump
+	l.Info("this is a test message", ecs.HTTPRequestMethod("POST"), ecs.HTTPResponseStatusCode("201"))
+	expected := `"http": {"request": {"body": {}, "method": "POST"}, "response": {"body": {"status_code": "201"}}}`
+	if got := buf.String(); !strings.Contains(got, expected) {
+		t.Fatalf("expected %v in %v", expected, got)
+	}
+}
+
+func Test_LoggerConsoleEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := ecs.NewConsoleEncoder(zapcore.EncoderConfig{
+		// Fixed timestamp for stable output
+		EncodeTime: func(_ time.Time, enc zapcore.PrimitiveArrayEncoder) { enc.AppendString("1990-11-26T17:56:11.000Z") },
+	})
+	l := NewECSLogger(Options{
+		BaseLoggerField: baseLoggerField,
+		BaseTags:        []string{"env"},
+		Logger:          zap.New(zapcore.NewCore(enc, zapcore.AddSync(buf), zap.DebugLevel)),
+	})
+
+	testName := "console_encoder"
+	t.Run(testName, func(t *testing.T) {
+		l.Info("this is a test message",
+			ecs.EventAction("test-started"),
+			ecs.HTTPRequestMethod("POST"),
+			zap.String(ecs.FieldStackTrace, "main.main()\n\t/src/main.go:42"),
+			zap.String("foo", "bar"),
+		)
+		test.AssertBytes(t, testName, buf.Bytes())
+	})
+}
+
+func Test_LoggerSampling(t *testing.T) {
+	now := time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)
+	newSampledLogger := func(opts SamplingOptions) (*bytes.Buffer, *zapECSLogger) {
+		buf, l := NewBufferedLogger(nil, nil)
+		l.sampler = newSampler(&opts)
+		l.sampler.now = func() time.Time { return now }
+		return buf, l
+	}
+	lines := func(buf *bytes.Buffer) []string {
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	testName := "sampling_summary"
+	t.Run(testName, func(t *testing.T) {
+		buf, l := newSampledLogger(SamplingOptions{First: 2, Thereafter: 3})
+
+		// Entries 1, 2, 5 and 8 of each key are logged, keyed by level, message, error.type and event.action
+		for i := 0; i < 10; i++ {
+			l.Error("request failed", zap.String(ecs.FieldErrorType, "*net.OpError"))
+			l.Error("request failed", zap.String(ecs.FieldErrorType, "*net.OpError"), ecs.EventAction("retry"))
+		}
+		l.With(zap.String(ecs.FieldErrorType, "*url.Error")).Warn("request failed")
+		if got := len(lines(buf)); got != 9 {
+			t.Fatalf("expected 9 entries, got %d", got)
+		}
+
+		// The summary of the 12 suppressed entries is written on flush
+		buf.Reset()
+		_ = l.Flush()
+		test.AssertBytesAsJSON(t, testName, SanitizeTestTimestamp(buf.Bytes()))
+	})
+
+	t.Run("sampling_summary_warn_disabled", func(t *testing.T) {
+		buf, l := newSampledLogger(SamplingOptions{First: 1, SummaryInterval: time.Minute})
+		level := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		l.logger = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(buildLoggerConfig().EncoderConfig), zapcore.AddSync(buf), level))
+
+		// The counts are kept while Warn is disabled, instead of being taken by a dropped summary
+		for i := 0; i < 4; i++ {
+			l.Error("request failed")
+		}
+		now = now.Add(time.Minute)
+		l.Error("request failed")
+		_ = l.Flush()
+		if got := len(lines(buf)); got != 2 {
+			t.Fatalf("expected 2 entries, got %d", got)
+		}
+
+		level.SetLevel(zap.WarnLevel)
+		buf.Reset()
+		_ = l.Flush()
+		if got := lines(buf); len(got) != 1 || !strings.Contains(got[0], `"suppressed":3`) {
+			t.Fatalf("expected the summary of the 3 suppressed entries, got %v", got)
+		}
+	})
+
+	t.Run("sampling_tick", func(t *testing.T) {
+		buf, l := newSampledLogger(SamplingOptions{First: 1, Tick: time.Second, SummaryInterval: time.Hour})
+		l.Info("tick")
+		l.Info("tick")
+		now = now.Add(time.Second)
+		l.Info("tick")
+		if got := len(lines(buf)); got != 2 {
+			t.Fatalf("expected 2 entries, got %d", got)
+		}
+	})
+
+	t.Run("rate_limit", func(t *testing.T) {
+		buf, l := newSampledLogger(SamplingOptions{RateLimitKey: "user.id", RateLimit: 1, RateLimitBurst: 2, SummaryInterval: time.Minute})
+
+		// Each user.id value is allowed a burst of 2 entries, refilled at 1 entry per second
+		for i := 0; i < 5; i++ {
+			l.Info("login attempt", zap.Int("user.id", 42))
+		}
+		l.Info("login attempt", zap.Int("user.id", 43))
+		l.Info("login attempt")
+		now = now.Add(time.Second)
+		l.Info("login attempt", zap.Int("user.id", 42))
+		l.Info("login attempt", zap.Int("user.id", 42))
+		if got := len(lines(buf)); got != 5 {
+			t.Fatalf("expected 5 entries, got %d", got)
+		}
+
+		// The summary is written along with the first entry after the summary interval
+		buf.Reset()
+		now = now.Add(time.Minute)
+		l.Info("login attempt", zap.Int("user.id", 44))
+		if got := lines(buf); len(got) != 2 || !strings.Contains(got[0], `"suppressed":4`) {
+			t.Fatalf("expected the summary and the entry, got %v", got)
+		}
+	})
+}
+
+// lockedWriteSyncer is a buffer safe for concurrent writes and reads
+type lockedWriteSyncer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *lockedWriteSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *lockedWriteSyncer) Sync() error {
+	return nil
+}
+
+func (s *lockedWriteSyncer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func Test_LoggerSamplingPeriodicSummary(t *testing.T) {
+	ws := &lockedWriteSyncer{}
+	jsonEncoder := zapcore.NewJSONEncoder(buildLoggerConfig().EncoderConfig)
+	l := NewECSLogger(Options{
+		Logger:   zap.New(zapcore.NewCore(jsonEncoder, ws, zap.DebugLevel)),
+		Sampling: &SamplingOptions{First: 1, SummaryInterval: 10 * time.Millisecond},
+	})
+
+	// The summary is written without waiting for another entry
+	l.Info("request failed")
+	l.Info("request failed")
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(ws.String(), "suppressed 1 log entries") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the periodic summary, got %v", ws.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Flush, as called on every recovered panic, keeps the periodic summaries running
+	_ = l.Flush()
+	l.Info("request failed")
+	deadline = time.Now().Add(time.Second)
+	for strings.Count(ws.String(), suppressedAction) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the periodic summary after Flush, got %v", ws.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Close stops the periodic summaries, which are then written along with the next entry
+	_ = l.Close()
+	l.Info("request failed")
+	time.Sleep(50 * time.Millisecond)
+	if got := strings.Count(ws.String(), suppressedAction); got != 2 {
+		t.Fatalf("expected no summary after Close, got %v", ws.String())
+	}
+	l.Info("request served")
+	if got := strings.Count(ws.String(), suppressedAction); got != 3 {
+		t.Fatalf("expected the summary along with the entry, got %v", ws.String())
+	}
+}
+
+func Test_LoggerOutputs(t *testing.T) {
+	// Fixed timestamp for stable console output, while @timestamp is sanitized for the JSON outputs
+	encoderConfig := zapcore.EncoderConfig{
+		EncodeTime: func(_ time.Time, enc zapcore.PrimitiveArrayEncoder) { enc.AppendString("1990-11-26T17:56:11.000Z") },
+	}
+	stdout, alerts, debug, audit := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	l := NewECSLogger(Options{
+		Outputs: []Output{
+			{Encoder: ecs.NewJSONEncoder(encoderConfig), WriteSyncer: zapcore.AddSync(stdout), Level: zap.InfoLevel},
+			{Encoder: ecs.NewJSONEncoder(encoderConfig), WriteSyncer: zapcore.AddSync(alerts), Level: zap.ErrorLevel},
+			{
+				Encoder:     ecs.NewConsoleEncoder(encoderConfig),
+				WriteSyncer: zapcore.AddSync(debug),
+				Level:       zap.LevelEnablerFunc(func(lvl zapcore.Level) bool { return lvl == zap.DebugLevel }),
+			},
+			{
+				Encoder:     ecs.NewJSONEncoder(encoderConfig),
+				WriteSyncer: zapcore.AddSync(audit),
+				Filter:      FilterAll(FilterField(ecs.FieldEventCategory, string(ecs.EventCategoryIAM)), FilterNot(FilterTag("test"))),
+			},
+		},
+	})
+
+	l.Debug("cache miss", zap.String("foo", "bar"))
+	l.Info("request served")
+	l.Error("request failed", zap.String(ecs.FieldErrorType, "*net.OpError"))
+	l.Info("user created", ecs.EventCategories(ecs.EventCategoryIAM, ecs.EventCategoryConfiguration), ecs.EventTypeOf(ecs.EventTypeCreation))
+	l.WithTags("test").Info("test user created", ecs.EventCategoryOf(ecs.EventCategoryIAM))
+	l.With(ecs.EventCategoryOf(ecs.EventCategoryIAM)).Debug("user deleted")
+
+	testName := "outputs"
+	t.Run(testName, func(t *testing.T) {
+		out := &bytes.Buffer{}
+		for _, o := range []struct {
+			name string
+			buf  *bytes.Buffer
+		}{{"stdout", stdout}, {"alerts", alerts}, {"debug", debug}, {"audit", audit}} {
+			fmt.Fprintf(out, "# %v\n", o.name)
+			out.Write(o.buf.Bytes())
+		}
+		test.AssertBytes(t, testName, SanitizeECSTimestamp(out.Bytes()))
+	})
+
+	t.Run("default_encoder", func(t *testing.T) {
+		// The default encoder writes ISO 8601 times and the level once
+		buf := &bytes.Buffer{}
+		l := NewECSLogger(Options{Outputs: []Output{{WriteSyncer: zapcore.AddSync(buf)}}})
+		l.Info("request served", zap.Time("event.start", time.Date(1990, time.November, 26, 17, 56, 11, 0, time.UTC)))
+		if !ecsTimestampRegexp.Match(buf.Bytes()) || strings.Count(buf.String(), `"info"`) != 1 ||
+			!strings.Contains(buf.String(), `"start":"1990-11-26T17:56:11.000Z"`) {
+			t.Fatalf("expected ISO 8601 times and a single level, got %v", buf.String())
+		}
+	})
+
+	t.Run("zap_context", func(t *testing.T) {
+		// Filters also apply to the context of the zap loggers sharing the output
+		buf := &bytes.Buffer{}
+		o := Output{WriteSyncer: zapcore.AddSync(buf), Filter: FilterField(ecs.FieldEventCategory, string(ecs.EventCategoryIAM))}
+		logger := zap.New(o.core())
+		logger.Info("user created")
+		logger.With(ecs.EventCategoryOf(ecs.EventCategoryIAM)).Info("user deleted")
+		if got := strings.Count(buf.String(), "\n"); got != 1 || !strings.Contains(buf.String(), "user deleted") {
+			t.Fatalf("expected only the entry with context, got %v", buf.String())
+		}
+	})
+}
+
+func Test_EntryFieldsFilters(t *testing.T) {
+	fields := EntryFields{
+		"service.name": "api",
+		"event":        map[string]interface{}{"kind": "event", "category": []interface{}{"iam", "configuration"}, "dataset": "api.audit"},
+		"labels":       map[string]interface{}{"attempts": 3},
+		"tags":         []interface{}{"env", "audit"},
+	}
+	tests := []struct {
+		name     string
+		filter   OutputFilter
+		expected bool
+	}{
+		{name: "dotted_key", filter: FilterField(ecs.FieldServiceName, "api"), expected: true},
+		{name: "object_field", filter: FilterField(ecs.FieldEventDataset, "api.audit"), expected: true},
+		{name: "array_field", filter: FilterField(ecs.FieldEventCategory, "web", "iam"), expected: true},
+		{name: "numeric_field", filter: FilterField("labels.attempts", "3"), expected: true},
+		{name: "value_mismatch", filter: FilterField(ecs.FieldEventKind, "metric"), expected: false},
+		{name: "missing_field", filter: FilterField(ecs.FieldEventOutcome, "success"), expected: false},
+		{name: "tag", filter: FilterTag("audit"), expected: true},
+		{name: "all", filter: FilterAll(FilterTag("audit"), FilterTag("test")), expected: false},
+		{name: "any", filter: FilterAny(FilterTag("audit"), FilterTag("test")), expected: true},
+		{name: "not", filter: FilterNot(FilterTag("test")), expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter(fields); got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_LoggerDataStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults []zap.Field
+		fields   []zap.Field
+	}{
+		{
+			name:     "data_stream_defaults",
+			defaults: newDataStreamDefaults("", "myservice", ""),
+		},
+		{
+			name:     "data_stream_event_dataset",
+			defaults: newDataStreamDefaults("", "myservice", "production"),
+			fields:   []zap.Field{ecs.EventDataset("myservice.audit")},
+		},
+		{
+			name:     "data_stream_sanitized",
+			defaults: newDataStreamDefaults("", "myservice", "production"),
+			fields:   []zap.Field{zap.String(ecs.FieldDataStreamNamespace, "Staging-EU"), zap.String(ecs.FieldDataStreamDataset, "My Service")},
+		},
+		{
+			name:     "data_stream_dataset_mismatch",
+			defaults: newDataStreamDefaults("", "myservice", "production"),
+			fields:   []zap.Field{ecs.EventDataset("myservice.audit"), zap.String(ecs.FieldDataStreamDataset, "My Service")},
+		},
+		{
+			name:     "data_stream_event_dataset_sanitized",
+			defaults: newDataStreamDefaults("", "myservice", "production"),
+			fields:   []zap.Field{ecs.EventDataset("MyService/Audit")},
+		},
+		{
+			name:     "data_stream_disallowed_type",
+			defaults: newDataStreamDefaults("", "myservice", "production"),
+			fields:   []zap.Field{zap.String(ecs.FieldDataStreamType, "events")},
+		},
+		{
+			name:   "data_stream_no_defaults",
+			fields: []zap.Field{ecs.DataStreamDataset("myservice.access")},
+		},
+		{
+			name:   "data_stream_disabled",
+			fields: []zap.Field{ecs.EventDataset("myservice.access")},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			buf, l := NewBufferedLogger(nil, nil)
+			l.dataStream = tt.defaults
+
+			l.Info("this is a test message", tt.fields...)
+			test.AssertBytesAsJSON(t, tt.name, SanitizeTestTimestamp(buf.Bytes()))
+		})
+	}
+}
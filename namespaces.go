@@ -0,0 +1,129 @@
+package zapecs
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lggomez/zap-ecs/internal/objects"
+	"go.uber.org/zap"
+)
+
+// namespaceRoute routes the custom fields with the given key prefix to a top level object
+type namespaceRoute struct {
+	prefix string
+	object string
+}
+
+// customNamespaces holds the top level objects receiving the custom (non ECS) fields
+type customNamespaces struct {
+	// Sorted by descending prefix length, so that the most specific prefix wins
+	routes        []namespaceRoute
+	defaultObject string
+}
+
+// customObject is a top level object being accumulated from custom fields
+type customObject struct {
+	name   string
+	fields []zap.Field
+	object objects.PathObject
+}
+
+// ecsFieldSets are the top level ECS field sets, which custom namespace objects must not be
+// named as, along with the root keys written by the logger
+var ecsFieldSets = map[string]struct{}{
+	"agent": {}, "as": {}, "client": {}, "cloud": {}, "container": {}, "data_stream": {}, "destination": {},
+	"device": {}, "dll": {}, "dns": {}, "ecs": {}, "email": {}, "error": {}, "event": {}, "faas": {},
+	"file": {}, "group": {}, "host": {}, "http": {}, "log": {}, "network": {}, "observer": {},
+	"orchestrator": {}, "organization": {}, "package": {}, "process": {}, "registry": {}, "related": {},
+	"rule": {}, "server": {}, "service": {}, "source": {}, "span": {}, "threat": {}, "tls": {},
+	"trace": {}, "transaction": {}, "url": {}, "user": {}, "user_agent": {}, "vulnerability": {},
+	"kubernetes": {},
+}
+
+// isReservedObject reports whether the name is an ECS field set or a root key of the entries,
+// such as labels, which a custom namespace object would be duplicating
+func isReservedObject(name string) bool {
+	if _, found := ecsFieldSets[name]; found {
+		return true
+	}
+	_, found := rootKeys[name]
+	return found
+}
+
+// newCustomNamespaces builds the namespace routes from a key prefix to object name mapping.
+// Prefixes can be given as "order", "order." or "order.*". Routes to reserved object names are
+// rejected, as is a reserved default object, whose fields are then added to labels
+func newCustomNamespaces(routes map[string]string, defaultObject string) customNamespaces {
+	if isReservedObject(defaultObject) {
+		defaultObject = ""
+	}
+	c := customNamespaces{
+		routes:        make([]namespaceRoute, 0, len(routes)),
+		defaultObject: defaultObject,
+	}
+	for prefix, object := range routes {
+		prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), ".")
+		if prefix == "" || object == "" || isReservedObject(object) {
+			continue
+		}
+		c.routes = append(c.routes, namespaceRoute{prefix: prefix + ".", object: object})
+	}
+	sort.Slice(c.routes, func(i, j int) bool {
+		if len(c.routes[i].prefix) != len(c.routes[j].prefix) {
+			return len(c.routes[i].prefix) > len(c.routes[j].prefix)
+		}
+		return c.routes[i].prefix < c.routes[j].prefix
+	})
+	return c
+}
+
+// matchRoute returns the object of the route matching the key, along with the key
+// relative to it
+func (c customNamespaces) matchRoute(key string) (object, objectKey string, ok bool) {
+	for _, r := range c.routes {
+		if strings.HasPrefix(key, r.prefix) {
+			return r.object, key[len(r.prefix):], true
+		}
+	}
+	return "", "", false
+}
+
+// route returns the object receiving the custom field key, falling back to the default
+// object. Keys routed to the default object keep their full path
+func (c customNamespaces) route(key string) (object, objectKey string, ok bool) {
+	if object, objectKey, ok = c.matchRoute(key); ok {
+		return object, objectKey, true
+	}
+	if c.defaultObject != "" {
+		return c.defaultObject, key, true
+	}
+	return "", "", false
+}
+
+// isObject reports whether the name is one of the custom namespace objects
+func (c customNamespaces) isObject(name string) bool {
+	for _, r := range c.routes {
+		if r.object == name {
+			return true
+		}
+	}
+	return false
+}
+
+// appendCustomField adds the field to the given top level object
+func (a *fieldAccumulators) appendCustomField(object string, f zap.Field) {
+	for i := range a.customFieldsAccum {
+		if a.customFieldsAccum[i].name == object {
+			a.customFieldsAccum[i].fields = append(a.customFieldsAccum[i].fields, f)
+			return
+		}
+	}
+	// Reuse the pooled objects beyond the current length, if any
+	if n := len(a.customFieldsAccum); n < cap(a.customFieldsAccum) {
+		a.customFieldsAccum = a.customFieldsAccum[:n+1]
+		a.customFieldsAccum[n].name = object
+		a.customFieldsAccum[n].fields = append(a.customFieldsAccum[n].fields, f)
+		return
+	}
+	a.customFieldsAccum = append(a.customFieldsAccum, customObject{name: object, fields: []zap.Field{f}})
+}
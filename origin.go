@@ -0,0 +1,59 @@
+package zapecs
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+)
+
+// originCallerSkip skips the originFields frame, so that runtime.Caller starts at its caller
+const originCallerSkip = 1
+
+// originFields returns the log.origin.* fields of the logger consumer call site, if the
+// origin is enabled for the given level. skip is the number of frames between the caller and
+// the logger consumer, unless the logger has a fixed origin frame
+func (l zapECSLogger) originFields(lvl Level, skip int) []zap.Field {
+	if l.originLevel == nil || !l.originLevel.Enabled(lvl) {
+		return nil
+	}
+
+	if l.originFrame != nil {
+		return frameOriginFields(*l.originFrame)
+	}
+	pc, file, line, ok := runtime.Caller(originCallerSkip + skip + l.callerSkip)
+	if !ok {
+		return nil
+	}
+	frame := runtime.Frame{File: file, Line: line}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		frame.Function = fn.Name()
+	}
+	return frameOriginFields(frame)
+}
+
+// frameOriginFields returns the log.origin.* fields of a frame
+func frameOriginFields(frame runtime.Frame) []zap.Field {
+	fields := make([]zap.Field, 0, 3)
+	fields = append(fields,
+		ecs.LogOriginFileName(trimOriginPath(frame.File)),
+		ecs.LogOriginFileLine(frame.Line))
+	if frame.Function != "" {
+		fields = append(fields, ecs.LogOriginFunction(frame.Function))
+	}
+	return fields
+}
+
+// trimOriginPath keeps the package directory and file name of a source file path,
+// as in /home/user/go/src/app/pkg/file.go -> pkg/file.go
+func trimOriginPath(file string) string {
+	idx := strings.LastIndexByte(file, '/')
+	if idx < 0 {
+		return file
+	}
+	if idx = strings.LastIndexByte(file[:idx], '/'); idx < 0 {
+		return file
+	}
+	return file[idx+1:]
+}
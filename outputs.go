@@ -0,0 +1,178 @@
+package zapecs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Output is an additional destination of the logger entries, teed with the Logger core
+type Output struct {
+	// Encoder encodes the output entries. Nil means ecs.NewJSONEncoder(ecs.NewEncoderConfig())
+	Encoder zapcore.Encoder
+	// WriteSyncer receives the encoded entries
+	WriteSyncer zapcore.WriteSyncer
+	// Level enables the levels of the output entries. Nil enables all levels
+	Level zapcore.LevelEnabler
+	// Filter selects the output entries by their fields. Nil selects all entries
+	Filter OutputFilter
+}
+
+// OutputFilter reports whether an entry is written to an output, given its encoded fields
+type OutputFilter func(fields EntryFields) bool
+
+// EntryFields are the encoded fields of an entry, including the ECS objects built by the logger
+type EntryFields map[string]interface{}
+
+// Value returns the value of the field with the given dotted key (such as event.kind), looking
+// it up through the entry objects
+func (f EntryFields) Value(key string) (interface{}, bool) {
+	if v, found := f[key]; found {
+		return v, true
+	}
+	for i := strings.IndexByte(key, '.'); i >= 0; i = nextDot(key, i) {
+		if object, isObject := f[key[:i]].(map[string]interface{}); isObject {
+			if v, found := EntryFields(object).Value(key[i+1:]); found {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// nextDot returns the index of the dot following the one at i, or -1
+func nextDot(key string, i int) int {
+	if j := strings.IndexByte(key[i+1:], '.'); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
+
+// FilterField selects the entries whose field with the given dotted key has any of the values.
+// Array fields, such as event.category, match if any of their elements does
+func FilterField(key string, values ...string) OutputFilter {
+	return func(fields EntryFields) bool {
+		v, found := fields.Value(key)
+		if !found {
+			return false
+		}
+		elems, isArray := v.([]interface{})
+		if !isArray {
+			elems = []interface{}{v}
+		}
+		for _, elem := range elems {
+			s := fmt.Sprint(elem)
+			for _, value := range values {
+				if s == value {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// FilterTag selects the entries with the given tag
+func FilterTag(tag string) OutputFilter {
+	return FilterField(ecs.FieldTags, tag)
+}
+
+// FilterAll selects the entries selected by all the filters
+func FilterAll(filters ...OutputFilter) OutputFilter {
+	return func(fields EntryFields) bool {
+		for _, filter := range filters {
+			if !filter(fields) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterAny selects the entries selected by any of the filters
+func FilterAny(filters ...OutputFilter) OutputFilter {
+	return func(fields EntryFields) bool {
+		for _, filter := range filters {
+			if filter(fields) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterNot selects the entries not selected by the filter
+func FilterNot(filter OutputFilter) OutputFilter {
+	return func(fields EntryFields) bool {
+		return !filter(fields)
+	}
+}
+
+// withOutputs tees the logger core, if any, with the output cores
+func withOutputs(logger *zap.Logger, outputs []Output) *zap.Logger {
+	cores := make([]zapcore.Core, 0, len(outputs)+1)
+	for _, o := range outputs {
+		cores = append(cores, o.core())
+	}
+	if logger == nil {
+		return zap.New(zapcore.NewTee(cores...))
+	}
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(append([]zapcore.Core{core}, cores...)...)
+	}))
+}
+
+func (o Output) core() zapcore.Core {
+	enc := o.Encoder
+	if enc == nil {
+		enc = ecs.NewJSONEncoder(ecs.NewEncoderConfig())
+	}
+	level := o.Level
+	if level == nil {
+		level = zap.LevelEnablerFunc(func(zapcore.Level) bool { return true })
+	}
+
+	core := zapcore.NewCore(enc, o.WriteSyncer, level)
+	if o.Filter == nil {
+		return core
+	}
+	return &filterCore{Core: core, filter: o.Filter}
+}
+
+// filterCore writes the entries selected by its filter to the wrapped core
+type filterCore struct {
+	zapcore.Core
+	filter  OutputFilter
+	context []zapcore.Field
+}
+
+func (c *filterCore) With(fields []zapcore.Field) zapcore.Core {
+	context := make([]zapcore.Field, 0, len(c.context)+len(fields))
+	context = append(context, c.context...)
+	context = append(context, fields...)
+	return &filterCore{Core: c.Core.With(fields), filter: c.filter, context: context}
+}
+
+func (c *filterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *filterCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	m := zapcore.NewMapObjectEncoder()
+	for _, field := range c.context {
+		field.AddTo(m)
+	}
+	for _, field := range fields {
+		field.AddTo(m)
+	}
+	if !c.filter(m.Fields) {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
@@ -0,0 +1,85 @@
+package zapecs
+
+import (
+	"os"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	errorTypePanic  = "panic"
+	defaultExitCode = 1
+)
+
+// FatalHook is run after a Fatal entry is written and the logger is flushed, replacing
+// the zap os.Exit(1) behavior
+type FatalHook func(msg string)
+
+// FatalExit returns a FatalHook that terminates the process with the given exit code
+func FatalExit(code int) FatalHook {
+	return func(string) {
+		os.Exit(code)
+	}
+}
+
+// FatalNoop is a FatalHook that resumes the execution after the Fatal call, intended for tests
+func FatalNoop(string) {}
+
+func (l zapECSLogger) fatalHook() FatalHook {
+	if l.onFatal == nil {
+		return FatalExit(defaultExitCode)
+	}
+	return l.onFatal
+}
+
+// writeFatal writes the fatal entry, replacing the zap exit with a recovered panic so that
+// the logger can be flushed and the fatal hook run afterwards
+func (l zapECSLogger) writeFatal(msg string, fields []zap.Field) {
+	defer func() {
+		// zap panics with the entry message, any other value is propagated
+		if r := recover(); r != nil && r != msg {
+			panic(r)
+		}
+	}()
+	l.logger.WithOptions(zap.OnFatal(zapcore.WriteThenPanic), zap.AddCallerSkip(1)).Fatal(msg, fields...)
+}
+
+// withPanicFields returns a copy of fields enriched with the ECS fields describing a panic
+// raised by the logger. Only the keys missing from the entry fields, With context and base
+// (static and provided) labels are added, so that the user supplied ones are kept regardless
+// of the duplicate policy
+func (l zapECSLogger) withPanicFields(msg string, fields []zap.Field) []zap.Field {
+	// Providers are evaluated once, as they may be expensive
+	var provided []zap.Field
+	for _, provider := range l.labelProviders {
+		provided = append(provided, provider.Labels()...)
+	}
+
+	enriched := make([]zap.Field, 0, len(fields)+3)
+	enriched = append(enriched, fields...)
+	for _, field := range []zap.Field{
+		ecs.EventKindOf(ecs.EventKindEvent),
+		zap.String(ecs.FieldErrorType, errorTypePanic),
+		zap.String(ecs.FieldErrorMessage, msg),
+	} {
+		if !l.hasEntryKey(fields, provided, field.Key) {
+			enriched = append(enriched, field)
+		}
+	}
+	return enriched
+}
+
+// hasEntryKey reports whether the entry fields, With context, base labels or provided labels
+// have the given key
+func (l zapECSLogger) hasEntryKey(fields, provided []zap.Field, key string) bool {
+	for _, fieldSet := range [][]zap.Field{fields, l.baseLabels, provided} {
+		for _, field := range fieldSet {
+			if field.Key == key {
+				return true
+			}
+		}
+	}
+	return hasFieldKey(l.contextFields, key)
+}
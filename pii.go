@@ -0,0 +1,76 @@
+package zapecs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// PIIPolicy determines how the logger handles personally identifiable fields
+type PIIPolicy int
+
+const (
+	// PIIKeep logs PII fields as is
+	PIIKeep PIIPolicy = iota
+	// PIIHash replaces PII field values with their hex encoded HMAC-SHA256, keyed by
+	// Options.PIIHashKey. Without a key, the plain SHA-256 hash is used, which is not a privacy
+	// guarantee: low entropy values such as emails can be recovered by hashing the candidates
+	PIIHash
+	// PIIDrop omits PII fields from the entries
+	PIIDrop
+)
+
+// newPIIFieldSet builds the lookup set of PII field keys, defaulting to ecs.DefaultPIIFields
+func newPIIFieldSet(keys []string) map[string]struct{} {
+	if keys == nil {
+		keys = ecs.DefaultPIIFields
+	}
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[key] = struct{}{}
+	}
+	return set
+}
+
+// applyPIIPolicy transforms the field according to the logger PII policy. The returned
+// boolean is false if the field must be dropped
+func (l zapECSLogger) applyPIIPolicy(field zap.Field) (zap.Field, bool) {
+	if l.piiPolicy == PIIKeep {
+		return field, true
+	}
+	if _, found := l.piiFields[field.Key]; !found {
+		return field, true
+	}
+
+	switch l.piiPolicy {
+	case PIIDrop:
+		return field, false
+	case PIIHash:
+		return zap.String(field.Key, hashPIIValue(field, l.piiHashKey)), true
+	default:
+		return field, true
+	}
+}
+
+// hashPIIValue returns the hex encoded HMAC-SHA256 of the field value representation, or its
+// SHA-256 hash if there is no key
+func hashPIIValue(field zap.Field, key []byte) string {
+	value := field.String
+	if field.Type != zapcore.StringType {
+		enc := zapcore.NewMapObjectEncoder()
+		field.AddTo(enc)
+		value = fmt.Sprint(enc.Fields[field.Key])
+	}
+	if len(key) == 0 {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package zapecs
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LabelProvider provides base labels that are evaluated on each entry, for values that
+// change over time (feature flags, configuration versions, leadership roles...)
+type LabelProvider interface {
+	Labels() []zap.Field
+}
+
+// LabelProviderFunc adapts a function to a LabelProvider
+type LabelProviderFunc func() []zap.Field
+
+func (f LabelProviderFunc) Labels() []zap.Field {
+	return f()
+}
+
+// cachedLabels are the provided labels along with their expiration time
+type cachedLabels struct {
+	fields []zap.Field
+	expiry time.Time
+}
+
+type cachedLabelProvider struct {
+	provider LabelProvider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache atomic.Value // *cachedLabels
+}
+
+// CachedLabelProvider returns a LabelProvider that evaluates the given provider at most once
+// per ttl, for providers that are expensive to evaluate on each entry
+func CachedLabelProvider(provider LabelProvider, ttl time.Duration) LabelProvider {
+	return &cachedLabelProvider{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+func (c *cachedLabelProvider) Labels() []zap.Field {
+	now := c.now()
+	if cached, ok := c.cache.Load().(*cachedLabels); ok && now.Before(cached.expiry) {
+		return cached.fields
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another goroutine may have refreshed the labels while waiting for the lock
+	if cached, ok := c.cache.Load().(*cachedLabels); ok && now.Before(cached.expiry) {
+		return cached.fields
+	}
+	fields := c.provider.Labels()
+	c.cache.Store(&cachedLabels{fields: fields, expiry: now.Add(c.ttl)})
+	return fields
+}
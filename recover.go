@@ -0,0 +1,147 @@
+package zapecs
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+)
+
+const defaultRecoverMessage = "panic recovered"
+
+// RecoverOptions configures the logging of recovered panics
+type RecoverOptions struct {
+	// Message is the crash entry message. Defaults to "panic recovered"
+	Message string
+	// Level is the crash entry level. Nil means ErrorLevel
+	Level *Level
+	// Repanic propagates the panic after it is logged and the logger flushed
+	Repanic bool
+	// StacktraceFormat determines the panic stack trace representation. Defaults to StacktraceCompact
+	StacktraceFormat StacktraceFormat
+	// StacktraceMaxSize caps the panic stack trace size in bytes. Zero means 32KiB
+	StacktraceMaxSize int
+	// Fields are additional fields for the crash entry
+	Fields []zap.Field
+}
+
+// RecoverAndLog recovers a panic and logs it as an ECS crash event. It must be deferred directly:
+//
+//	defer zapecs.RecoverAndLog(logger, zapecs.RecoverOptions{})
+func RecoverAndLog(logger Logger, opts RecoverOptions) {
+	if r := recover(); r != nil {
+		logRecovered(logger, opts, r)
+		if opts.Repanic {
+			panic(r)
+		}
+	}
+}
+
+// RecoverMiddleware returns an http.Handler middleware that recovers the handler panics and logs
+// them as ECS crash events, replying with an internal server error unless opts.Repanic is set.
+// http.ErrAbortHandler panics are propagated without being logged, as done by net/http
+func RecoverMiddleware(logger Logger, opts RecoverOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler { //nolint:errorlint,goerr113 // sentinel panic value
+					panic(rec)
+				}
+
+				requestOpts := opts
+				requestOpts.Fields = append([]zap.Field{ecs.HTTPRequestMethod(r.Method)}, opts.Fields...)
+				logRecovered(logger, requestOpts, rec)
+				if opts.Repanic {
+					panic(rec)
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logRecovered logs the recovered panic value along with the panicking goroutine stack trace.
+// The log origin of ECS loggers is the panicking frame, rather than the recovery call
+func logRecovered(logger Logger, opts RecoverOptions, r interface{}) {
+	if ecsLogger, ok := logger.(*zapECSLogger); ok {
+		if frame, found := panicFrame(); found {
+			child := *ecsLogger
+			child.originFrame = &frame
+			logger = &child
+		}
+	}
+
+	fields := make([]zap.Field, 0, len(opts.Fields)+5)
+	fields = append(fields, opts.Fields...)
+	fields = append(fields,
+		zap.String(ecs.FieldErrorType, fmt.Sprintf("%T", r)),
+		zap.String(ecs.FieldErrorMessage, panicMessage(r)),
+		zap.String(ecs.FieldStackTrace, captureStacktrace(opts.StacktraceFormat, opts.StacktraceMaxSize, isPanicFrame)),
+		ecs.EventKindOf(ecs.EventKindEvent),
+		ecs.EventOutcomeOf(ecs.EventOutcomeFailure))
+
+	msg := opts.Message
+	if msg == "" {
+		msg = defaultRecoverMessage
+	}
+
+	lvl := ErrorLevel
+	if opts.Level != nil {
+		lvl = *opts.Level
+	}
+
+	switch lvl {
+	case DebugLevel:
+		logger.Debug(msg, fields...)
+	case InfoLevel:
+		logger.Info(msg, fields...)
+	case WarnLevel:
+		logger.Warn(msg, fields...)
+	case DPanicLevel:
+		logger.DPanic(msg, fields...)
+	case PanicLevel:
+		logger.Panic(msg, fields...)
+	case FatalLevel:
+		logger.Fatal(msg, fields...)
+	default:
+		logger.Error(msg, fields...)
+	}
+	_ = logger.Flush()
+}
+
+func panicMessage(r interface{}) string {
+	if err, ok := r.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(r)
+}
+
+// panicFrame returns the first frame of the current goroutine that is not part of the library
+// or the panic machinery, that is, the panicking one while recovering
+func panicFrame() (runtime.Frame, bool) {
+	pcs := make([]uintptr, maxStacktraceDepth)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isPanicFrame(frame.Function, frame.File) {
+			return frame, true
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// isPanicFrame reports whether the frame belongs to the library or the runtime panic machinery,
+// so that the recovered stack trace starts on the panicking function
+func isPanicFrame(function, file string) bool {
+	return isLibraryFrame(function, file) || strings.HasPrefix(function, "runtime.") || strings.HasPrefix(function, "panic(")
+}
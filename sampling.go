@@ -0,0 +1,367 @@
+package zapecs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultSamplingTick    = time.Second
+	defaultSummaryInterval = time.Minute
+
+	// samplingBaseLevelKey is the top level object of the suppressed entries summary
+	samplingBaseLevelKey = "sampling"
+	suppressedAction     = "log-entries-suppressed"
+)
+
+// SamplingOptions configures the sampling and rate limiting of the Debug, Info, Warn and Error
+// entries. Sampling is keyed by the entry level, message, error.type and event.action, unlike
+// zap's sampler which keys on the message alone
+type SamplingOptions struct {
+	// Tick is the sampling window. Defaults to 1s
+	Tick time.Duration
+	// First is the number of entries logged per key and window, after which only every
+	// Thereafter-th entry is logged (none if zero). Zero disables sampling
+	First      int
+	Thereafter int
+	// RateLimitKey is the key of the field whose values are rate limited, such as user.id.
+	// Entries without it are not rate limited
+	RateLimitKey string
+	// RateLimit is the number of entries per second allowed for each value of RateLimitKey
+	RateLimit float64
+	// RateLimitBurst is the number of entries allowed at once for each value of RateLimitKey.
+	// Defaults to 1
+	RateLimitBurst int
+	// SummaryInterval is the minimum interval between the summaries of the suppressed entries,
+	// which are written along with the next entry, or every interval by a background goroutine
+	// until Close is called. Flush writes the pending summary regardless of the interval.
+	// Defaults to 1m
+	SummaryInterval time.Duration
+}
+
+// sampleKey identifies the entries sampled together
+type sampleKey struct {
+	level       Level
+	message     string
+	errorType   string
+	eventAction string
+}
+
+// tokenBucket holds the entries allowed for a rate limited value
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sampler holds the sampling state shared by a logger and its children
+type sampler struct {
+	opts SamplingOptions
+	now  func() time.Time
+
+	mu          sync.Mutex
+	windowEnd   time.Time
+	counts      map[sampleKey]int
+	buckets     map[string]*tokenBucket
+	suppressed  map[sampleKey]uint64
+	nextSummary time.Time
+
+	// stop ends the periodic summaries, whose goroutine closes done on return
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newSampler(opts *SamplingOptions) *sampler {
+	if opts == nil {
+		return nil
+	}
+	s := &sampler{
+		opts:       *opts,
+		now:        time.Now,
+		counts:     map[sampleKey]int{},
+		buckets:    map[string]*tokenBucket{},
+		suppressed: map[sampleKey]uint64{},
+	}
+	if s.opts.Tick <= 0 {
+		s.opts.Tick = defaultSamplingTick
+	}
+	if s.opts.RateLimitBurst <= 0 {
+		s.opts.RateLimitBurst = 1
+	}
+	if s.opts.SummaryInterval <= 0 {
+		s.opts.SummaryInterval = defaultSummaryInterval
+	}
+	return s
+}
+
+// suppressedCount is the number of entries suppressed for a key
+type suppressedCount struct {
+	sampleKey
+	count uint64
+}
+
+// suppressedCounts is the summary of the suppressed entries
+type suppressedCounts []suppressedCount
+
+// sample reports whether the entry is logged, writing the suppressed entries summary when due
+func (l zapECSLogger) sample(lvl Level, msg string, fields []zap.Field) bool {
+	if l.sampler == nil {
+		return true
+	}
+	key := sampleKey{
+		level:       lvl,
+		message:     msg,
+		errorType:   l.fieldKeyword(fields, ecs.FieldErrorType),
+		eventAction: l.fieldKeyword(fields, ecs.FieldEventAction),
+	}
+	var rateLimitValue string
+	if l.sampler.opts.RateLimitKey != "" && l.sampler.opts.RateLimit > 0 {
+		rateLimitValue = l.fieldKeyword(fields, l.sampler.opts.RateLimitKey)
+	}
+
+	allowed, summary := l.sampler.allow(key, rateLimitValue, l.summaryEnabled())
+	if len(summary) > 0 {
+		// sample is called by the Logger methods, so the consumer is two frames away
+		l.writeSamplingSummary(summary, 2)
+	}
+	return allowed
+}
+
+// fieldKeyword returns the keyword value of the entry or context field with the given key
+func (l zapECSLogger) fieldKeyword(fields []zap.Field, key string) string {
+	for _, field := range fields {
+		if field.Key == key {
+			kf, _ := keywordLabel(field)
+			return kf.String
+		}
+	}
+	for i := len(l.contextFields) - 1; i >= 0; i-- {
+		if l.contextFields[i].Key == key {
+			kf, _ := keywordLabel(l.contextFields[i].Field)
+			return kf.String
+		}
+	}
+	return ""
+}
+
+// allow reports whether the entry is logged, returning the suppressed entries summary if due
+// and summarize is set
+func (s *sampler) allow(key sampleKey, rateLimitValue string, summarize bool) (bool, suppressedCounts) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !now.Before(s.windowEnd) {
+		s.resetWindow(now)
+	}
+	allowed := s.sampled(key) && (rateLimitValue == "" || s.rateLimited(rateLimitValue, now))
+	if !allowed {
+		if len(s.suppressed) == 0 {
+			s.nextSummary = now.Add(s.opts.SummaryInterval)
+		}
+		s.suppressed[key]++
+	}
+
+	if !summarize || len(s.suppressed) == 0 || now.Before(s.nextSummary) {
+		return allowed, nil
+	}
+	return allowed, s.takeSummary()
+}
+
+// sampled applies the first-N-then-every-M sampling. The caller must hold mu
+func (s *sampler) sampled(key sampleKey) bool {
+	if s.opts.First <= 0 {
+		return true
+	}
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.opts.First {
+		return true
+	}
+	return s.opts.Thereafter > 0 && (n-s.opts.First)%s.opts.Thereafter == 0
+}
+
+// rateLimited applies the token bucket rate limiting of the value. The caller must hold mu
+func (s *sampler) rateLimited(value string, now time.Time) bool {
+	burst := float64(s.opts.RateLimitBurst)
+	bucket, ok := s.buckets[value]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		s.buckets[value] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * s.opts.RateLimit
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// resetWindow starts a new sampling window, discarding the counts of the previous one and the
+// buckets that were refilled since. The caller must hold mu
+func (s *sampler) resetWindow(now time.Time) {
+	s.windowEnd = now.Add(s.opts.Tick)
+	s.counts = make(map[sampleKey]int, len(s.counts))
+
+	if s.opts.RateLimit <= 0 {
+		return
+	}
+	refill := time.Duration(float64(s.opts.RateLimitBurst) / s.opts.RateLimit * float64(time.Second))
+	for value, bucket := range s.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(s.buckets, value)
+		}
+	}
+}
+
+// takeSummary returns the suppressed entries counts, sorted by key, and resets them. The
+// caller must hold mu
+func (s *sampler) takeSummary() suppressedCounts {
+	summary := make(suppressedCounts, 0, len(s.suppressed))
+	for key, count := range s.suppressed {
+		summary = append(summary, suppressedCount{sampleKey: key, count: count})
+	}
+	s.suppressed = map[sampleKey]uint64{}
+
+	sort.Slice(summary, func(i, j int) bool {
+		a, b := summary[i], summary[j]
+		switch {
+		case a.level != b.level:
+			return a.level < b.level
+		case a.message != b.message:
+			return a.message < b.message
+		case a.errorType != b.errorType:
+			return a.errorType < b.errorType
+		default:
+			return a.eventAction < b.eventAction
+		}
+	})
+	return summary
+}
+
+// startSummaries calls tick every SummaryInterval in the background to write the due summaries,
+// so that they are not delayed until the next entry, until stopSummaries is called
+func (s *sampler) startSummaries(tick func()) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.opts.SummaryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				tick()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSummaries stops the periodic summaries, if started, waiting for the pending write
+func (s *sampler) stopSummaries() {
+	if s.stop == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// dueSummary returns the suppressed entries counts if the summary interval elapsed
+func (s *sampler) dueSummary() suppressedCounts {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.suppressed) == 0 || now.Before(s.nextSummary) {
+		return nil
+	}
+	return s.takeSummary()
+}
+
+// flushSummary returns the pending suppressed entries counts, regardless of the summary interval
+func (s *sampler) flushSummary() suppressedCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.suppressed) == 0 {
+		return nil
+	}
+	return s.takeSummary()
+}
+
+// summaryEnabled reports whether the suppressed entries summaries can be written. It must be
+// checked before taking a summary, which resets the counts
+func (l zapECSLogger) summaryEnabled() bool {
+	return l.sampler != nil && l.logger.Core().Enabled(WarnLevel)
+}
+
+// writeSamplingSummary writes a metric event with the suppressed entries counts. skip is the
+// number of frames between the caller and the logger consumer
+func (l zapECSLogger) writeSamplingSummary(summary suppressedCounts, skip int) {
+	var total uint64
+	for _, c := range summary {
+		total += c.count
+	}
+
+	accums := l.encodeFields([]zap.Field{
+		ecs.EventKindOf(ecs.EventKindMetric),
+		ecs.EventAction(suppressedAction),
+	}, WarnLevel, skip+1)
+	accums.out = append(accums.out, zap.Object(samplingBaseLevelKey, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddUint64("suppressed", total)
+		return enc.AddArray("keys", summary)
+	})))
+	l.logger.Warn(fmt.Sprintf("suppressed %d log entries", total), accums.out...)
+	accums.release()
+}
+
+// writeDueSummary writes the summary due on the sampler ticks. There is no consumer call site,
+// so the log origin is omitted
+func (l zapECSLogger) writeDueSummary() {
+	if !l.summaryEnabled() {
+		return
+	}
+	if summary := l.sampler.dueSummary(); len(summary) > 0 {
+		l.originLevel = nil
+		l.writeSamplingSummary(summary, 0)
+	}
+}
+
+func (c suppressedCounts) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for i := range c {
+		if err := enc.AppendObject(&c[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *suppressedCount) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("level", c.level.String())
+	enc.AddString("message", c.message)
+	if c.errorType != "" {
+		enc.AddString("error_type", c.errorType)
+	}
+	if c.eventAction != "" {
+		enc.AddString("event_action", c.eventAction)
+	}
+	enc.AddUint64("count", c.count)
+	return nil
+}
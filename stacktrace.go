@@ -0,0 +1,140 @@
+package zapecs
+
+import (
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+)
+
+// StacktraceFormat determines the representation of the captured stack traces
+type StacktraceFormat int
+
+const (
+	// StacktraceCompact represents each frame as its function and file:line location, as zap does
+	StacktraceCompact StacktraceFormat = iota
+	// StacktraceFull represents the stack trace as returned by runtime/debug.Stack, including
+	// the goroutine header and the frame arguments and offsets
+	StacktraceFull
+)
+
+const (
+	defaultStacktraceMaxSize = 32 * 1024
+	maxStacktraceDepth       = 64
+	stacktraceTruncatedMark  = "\n...truncated"
+	zapPackagePrefix         = "go.uber.org/zap"
+)
+
+// sourceDir is the zap-ecs source directory, used to identify the library frames
+var sourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.ToSlash(filepath.Dir(file)) + "/"
+}()
+
+// stacktraceField returns the error.stack_trace field of the current goroutine, if the
+// stack trace capture is enabled for the given level
+func (l zapECSLogger) stacktraceField(lvl Level) (zap.Field, bool) {
+	if l.stacktraceLevel == nil || !l.stacktraceLevel.Enabled(lvl) {
+		return zap.Field{}, false
+	}
+
+	stack := captureStacktrace(l.stacktraceFormat, l.stacktraceMaxSize, isLibraryFrame)
+	return zap.String(ecs.FieldStackTrace, stack), true
+}
+
+// frameFilter reports whether a leading stack frame must be trimmed
+type frameFilter func(function, file string) bool
+
+// captureStacktrace returns the stack trace of the current goroutine in the given format,
+// trimming its leading frames as determined by trim
+func captureStacktrace(format StacktraceFormat, maxSize int, trim frameFilter) string {
+	var stack string
+	switch format {
+	case StacktraceFull:
+		stack = fullStacktrace(trim)
+	default:
+		stack = compactStacktrace(trim)
+	}
+	return truncateStacktrace(stack, maxSize)
+}
+
+// isLibraryFrame reports whether the frame belongs to zap or zap-ecs (excluding its tests)
+func isLibraryFrame(function, file string) bool {
+	if strings.HasPrefix(function, zapPackagePrefix) {
+		return true
+	}
+	return strings.HasPrefix(file, sourceDir) && !strings.HasSuffix(file, "_test.go")
+}
+
+// compactStacktrace returns the stack trace of the current goroutine as function and location
+// line pairs, skipping the leading frames matched by trim
+func compactStacktrace(trim frameFilter) string {
+	pcs := make([]uintptr, maxStacktraceDepth)
+	// Skip runtime.Callers and compactStacktrace
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	b := strings.Builder{}
+	leading := true
+	for {
+		frame, more := frames.Next()
+		if !leading || !trim(frame.Function, frame.File) {
+			leading = false
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(frame.Function)
+			b.WriteString("\n\t")
+			b.WriteString(frame.File)
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// fullStacktrace returns the runtime/debug.Stack representation of the current goroutine,
+// skipping the leading frames matched by trim
+func fullStacktrace(trim frameFilter) string {
+	lines := strings.Split(strings.TrimRight(string(debug.Stack()), "\n"), "\n")
+	if len(lines) < 3 {
+		return strings.Join(lines, "\n")
+	}
+
+	// The first line is the goroutine header, followed by function and location line pairs
+	i := 1
+	for ; i+1 < len(lines); i += 2 {
+		function := lines[i]
+		// Locations are formatted as "\t/path/to/file.go:line +0xoffset"
+		file := strings.TrimSpace(lines[i+1])
+		if idx := strings.LastIndexByte(file, ':'); idx > 0 {
+			file = file[:idx]
+		}
+		if !strings.HasPrefix(function, "runtime/debug.Stack") && !trim(function, file) {
+			break
+		}
+	}
+	return lines[0] + "\n" + strings.Join(lines[i:], "\n")
+}
+
+// truncateStacktrace caps the stack trace size, cutting it on a line boundary when possible
+func truncateStacktrace(stack string, maxSize int) string {
+	if maxSize <= 0 {
+		maxSize = defaultStacktraceMaxSize
+	}
+	if len(stack) <= maxSize {
+		return stack
+	}
+
+	cut := stack[:maxSize]
+	if idx := strings.LastIndexByte(cut, '\n'); idx > 0 {
+		cut = cut[:idx]
+	}
+	return cut + stacktraceTruncatedMark
+}
@@ -0,0 +1,74 @@
+package zapecs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// tagValues returns the tags carried by a tags field, which can be built with ecs.Tags,
+// ecs.Tag, zap.Strings or zap.String. Fields of any other type are ignored
+func tagValues(field zap.Field) ([]string, bool) {
+	switch field.Type {
+	case zapcore.SkipType:
+		tags, ok := field.Interface.([]string)
+		return tags, ok
+	case zapcore.StringType:
+		return []string{field.String}, true
+	case zapcore.ArrayMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		field.AddTo(enc)
+		values, ok := enc.Fields[field.Key].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		tags := make([]string, 0, len(values))
+		for _, value := range values {
+			tags = append(tags, fmt.Sprint(value))
+		}
+		return tags, true
+	default:
+		return nil, false
+	}
+}
+
+// normalizeTags trims the tags, discarding the empty and duplicated ones while keeping the
+// order of their first occurrence unless sorted is set
+func normalizeTags(tags []string, sorted bool) []string {
+	normalized := tags[:0]
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || containsTag(normalized, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	if sorted {
+		sort.Strings(normalized)
+	}
+	return normalized
+}
+
+// tagArray encodes the entry tags. It is used by pointer, so that the pooled tags are
+// not copied into an interface
+type tagArray []string
+
+func (t *tagArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, tag := range *t {
+		enc.AppendString(tag)
+	}
+	return nil
+}
+
+// containsTag does a linear lookup, as the tag lists are expected to be short
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package zapecs
+
+import (
+	"github.com/lggomez/zap-ecs/ecs"
+	"go.uber.org/zap"
+)
+
+// EventValidation determines how the logger handles event categorization fields
+// (event.kind, event.category, event.type and event.outcome) with values not allowed by ECS
+type EventValidation int
+
+const (
+	// EventValidationNone logs event fields as is
+	EventValidationNone EventValidation = iota
+	// EventValidationWarn logs event fields as is, emitting a warning entry for each invalid value
+	EventValidationWarn
+	// EventValidationReject omits the event fields with invalid values from the entries
+	EventValidationReject
+)
+
+const invalidFieldMessage = "zap-ecs: invalid ECS field value"
+
+// validateEventField checks the field according to the logger event validation policy. The
+// returned boolean is false if the field must be dropped. skip is the number of frames between
+// the caller and the logger consumer, so that warnings point to the logging call
+func (l zapECSLogger) validateEventField(field zap.Field, skip int) bool {
+	if l.eventValidation == EventValidationNone {
+		return true
+	}
+
+	err := ecs.ValidateEventField(field)
+	if err == nil {
+		return true
+	}
+
+	switch l.eventValidation {
+	case EventValidationWarn:
+		// The warning is not validated, as its base labels and With context may hold the
+		// invalid field as well
+		warner := l
+		warner.eventValidation = EventValidationNone
+		accums := warner.encodeFields([]zap.Field{ecs.Err(err)}, WarnLevel, skip+1)
+		l.logger.Warn(invalidFieldMessage, accums.out...)
+		accums.release()
+		return true
+	case EventValidationReject:
+		return false
+	default:
+		return true
+	}
+}